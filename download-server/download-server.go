@@ -1,52 +1,224 @@
 package main
 
 import (
+	"crypto/subtle"
+	"crypto/tls"
+	"flag"
 	"fmt"
+	"hash/crc32"
 	"io"
+	"log"
+	"math/rand"
 	"net/http"
 	"strconv"
+	"strings"
 
 	"github.com/faceair/clash-speedtest/speedtester"
+	"github.com/metacubex/quic-go/http3"
+	utls "github.com/metacubex/utls"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
 )
 
+var (
+	listenAddr = flag.String("listen", ":8080", "监听地址")
+	certFile   = flag.String("tls-cert", "", "TLS 证书文件路径")
+	keyFile    = flag.String("tls-key", "", "TLS 私钥文件路径")
+	selfSigned = flag.Bool("self-signed", false, "未指定证书时使用自动生成的自签名证书启用 TLS")
+	token      = flag.String("token", "", "访问令牌，设置后测速请求需携带 Authorization: Bearer <token>")
+	randomData = flag.Bool("random", true, "下载返回不可压缩的随机数据，-random=false 时返回全零数据")
+	enableH3   = flag.Bool("http3", false, "在同一端口上同时启用 HTTP/3(需要 TLS)")
+	rateLimit  = flag.Float64("rate-limit", 0, "每个客户端 IP 的限速，单位 MB/s，上传和下载分别计算，0 表示不限速")
+	maxBytes   = flag.Int64("max-bytes", 1<<30, "单次下载请求最多返回的字节数，请求的 bytes 超过时按该值返回")
+)
+
+// 服务端字节统计的响应头，客户端使用 download-server 后端时与自身统计的字节数比较
+const (
+	headerBytesSent       = speedtester.BytesSentHeader
+	headerBytesReceived   = speedtester.BytesReceivedHeader
+	headerPayloadChecksum = "X-Payload-Checksum"
+)
+
+// checksumTable 上传校验使用的 CRC32 表
+var checksumTable = crc32.MakeTable(crc32.Castagnoli)
+
 func main() {
-	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+	flag.Parse()
+
+	var downLimiter, upLimiter *clientLimiter
+	if *rateLimit > 0 {
+		downLimiter = newClientLimiter(*rateLimit * 1024 * 1024)
+		upLimiter = newClientLimiter(*rateLimit * 1024 * 1024)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "text/html")
 		w.WriteHeader(http.StatusOK)
 		w.Write([]byte(`<h1>SpeedTest Server</h1>`))
 	})
 
-	http.HandleFunc("/__down", func(w http.ResponseWriter, r *http.Request) {
+	mux.HandleFunc("/__ping", authorize(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "no-store")
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	mux.HandleFunc("/__down", authorize(func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodGet {
 			w.WriteHeader(http.StatusMethodNotAllowed)
 			return
 		}
 
-		byteSize, err := strconv.Atoi(r.URL.Query().Get("bytes"))
-		if err != nil {
+		byteSize, err := strconv.ParseInt(r.URL.Query().Get("bytes"), 10, 64)
+		if err != nil || byteSize <= 0 {
 			w.WriteHeader(http.StatusBadRequest)
-			w.Write([]byte(err.Error()))
+			w.Write([]byte("bytes must be a positive integer"))
 			return
 		}
+		if *maxBytes > 0 && byteSize > *maxBytes {
+			byteSize = *maxBytes
+		}
 
 		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=speedtest-%d.bin", byteSize))
 		w.Header().Set("Content-Type", "application/octet-stream")
+		// 实际发送的字节数在传输结束后通过 trailer 返回；设置 Content-Length 会使 HTTP/1.1 不再分块传输并丢弃 trailer，因此不设置
+		w.Header().Set("Trailer", headerBytesSent)
 		w.WriteHeader(http.StatusOK)
 
-		reader := speedtester.NewZeroReader(byteSize)
-		io.Copy(w, reader)
-	})
+		var reader io.Reader = speedtester.NewZeroReader(int(byteSize))
+		if *randomData {
+			// 可以通过 seed 参数指定种子，便于客户端校验下载内容
+			seed, err := strconv.ParseUint(r.URL.Query().Get("seed"), 10, 64)
+			if err != nil {
+				seed = rand.Uint64()
+			}
+			reader = speedtester.NewRandomReader(seed, int(byteSize))
+		}
+		var writer io.Writer = w
+		if downLimiter != nil {
+			writer = downLimiter.writer(r, w)
+		}
+		n, _ := io.Copy(writer, reader)
+		w.Header().Set(headerBytesSent, strconv.FormatInt(n, 10))
+	}))
 
-	http.HandleFunc("/__up", func(w http.ResponseWriter, r *http.Request) {
+	mux.HandleFunc("/__up", authorize(func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodPost {
 			w.WriteHeader(http.StatusMethodNotAllowed)
 			return
 		}
 
-		io.Copy(io.Discard, r.Body)
+		var reader io.Reader = r.Body
+		if upLimiter != nil {
+			reader = upLimiter.reader(r, r.Body)
+		}
+		checksum := crc32.New(checksumTable)
+		n, _ := io.Copy(checksum, reader)
+
+		w.Header().Set(headerBytesReceived, strconv.FormatInt(n, 10))
+		w.Header().Set(headerPayloadChecksum, fmt.Sprintf("%08x", checksum.Sum32()))
 
+		// 客户端提供了随机数据种子时，按种子重新生成数据并校验内容是否被篡改
+		if value := r.Header.Get(speedtester.PayloadSeedHeader); value != "" {
+			seed, err := strconv.ParseUint(value, 10, 64)
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write([]byte(err.Error()))
+				return
+			}
+			expected := crc32.New(checksumTable)
+			io.Copy(expected, speedtester.NewRandomReader(seed, int(n)))
+			if expected.Sum32() != checksum.Sum32() {
+				w.WriteHeader(http.StatusUnprocessableEntity)
+				w.Write([]byte("payload checksum mismatch"))
+				return
+			}
+		}
 		w.WriteHeader(http.StatusOK)
-	})
+	}))
+
+	tlsConfig, err := loadTLSConfig()
+	if err != nil {
+		log.Fatalf("load tls config failed: %v", err)
+	}
+
+	// 未启用 TLS 时通过 h2c 支持明文 HTTP/2
+	server := &http.Server{
+		Addr:    *listenAddr,
+		Handler: h2c.NewHandler(mux, &http2.Server{}),
+	}
+	if tlsConfig == nil {
+		if *enableH3 {
+			log.Fatalf("http3 requires tls, use -tls-cert/-tls-key or -self-signed")
+		}
+		log.Printf("speedtest server listening on http://%s", *listenAddr)
+		log.Fatal(server.ListenAndServe())
+	}
+
+	server.Handler = mux
+	server.TLSConfig = tlsConfig
+	if *enableH3 {
+		h3Server := &http3.Server{
+			Addr:      *listenAddr,
+			Handler:   mux,
+			TLSConfig: http3.ConfigureTLSConfig(quicTLSConfig(tlsConfig)),
+		}
+		// 通过 Alt-Svc 告知客户端可以使用 HTTP/3
+		server.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			h3Server.SetQUICHeaders(w.Header())
+			mux.ServeHTTP(w, r)
+		})
+		go func() {
+			log.Fatal(h3Server.ListenAndServe())
+		}()
+	}
+	log.Printf("speedtest server listening on https://%s", *listenAddr)
+	log.Fatal(server.ListenAndServeTLS("", ""))
+}
+
+// authorize 在设置了访问令牌时校验 Authorization 请求头
+func authorize(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if *token != "" {
+			provided, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if !ok || subtle.ConstantTimeCompare([]byte(provided), []byte(*token)) != 1 {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+		}
+		handler(w, r)
+	}
+}
+
+// loadTLSConfig 加载证书或生成自签名证书，未启用 TLS 时返回 nil
+func loadTLSConfig() (*tls.Config, error) {
+	var cert tls.Certificate
+	var err error
+	switch {
+	case *certFile != "" || *keyFile != "":
+		cert, err = tls.LoadX509KeyPair(*certFile, *keyFile)
+	case *selfSigned:
+		cert, err = generateSelfSignedCert()
+	default:
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		NextProtos:   []string{"h2", "http/1.1"},
+	}, nil
+}
 
-	http.ListenAndServe(":8080", nil)
+// quicTLSConfig 将证书转换为 HTTP/3 使用的 utls 配置
+func quicTLSConfig(config *tls.Config) *utls.Config {
+	certificates := make([]utls.Certificate, 0, len(config.Certificates))
+	for _, cert := range config.Certificates {
+		certificates = append(certificates, utls.Certificate{
+			Certificate: cert.Certificate,
+			PrivateKey:  cert.PrivateKey,
+		})
+	}
+	return &utls.Config{Certificates: certificates}
 }
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// generateSelfSignedCert 生成一年有效期的 ECDSA 自签名证书
+func generateSelfSignedCert() (tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: "clash-speedtest"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(365 * 24 * time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, nil
+}
+
+// limiterIdleTimeout 客户端限速器空闲多久后被清理
+const limiterIdleTimeout = 5 * time.Minute
+
+// clientLimiter 按客户端 IP 限制传输速度
+type clientLimiter struct {
+	mutex    sync.Mutex
+	limit    rate.Limit
+	burst    int
+	limiters map[string]*clientLimiterEntry
+}
+
+type clientLimiterEntry struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+func newClientLimiter(bytesPerSecond float64) *clientLimiter {
+	burst := int(bytesPerSecond / 10)
+	if burst < 32*1024 {
+		burst = 32 * 1024
+	}
+	return &clientLimiter{
+		limit:    rate.Limit(bytesPerSecond),
+		burst:    burst,
+		limiters: make(map[string]*clientLimiterEntry),
+	}
+}
+
+func (l *clientLimiter) get(r *http.Request) *rate.Limiter {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ip = r.RemoteAddr
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	now := time.Now()
+	for key, entry := range l.limiters {
+		if now.Sub(entry.lastSeen) > limiterIdleTimeout {
+			delete(l.limiters, key)
+		}
+	}
+	entry, ok := l.limiters[ip]
+	if !ok {
+		entry = &clientLimiterEntry{limiter: rate.NewLimiter(l.limit, l.burst)}
+		l.limiters[ip] = entry
+	}
+	entry.lastSeen = now
+	return entry.limiter
+}
+
+func (l *clientLimiter) writer(r *http.Request, w io.Writer) io.Writer {
+	return &limitedWriter{ctx: r.Context(), limiter: l.get(r), writer: w}
+}
+
+func (l *clientLimiter) reader(r *http.Request, reader io.Reader) io.Reader {
+	return &limitedReader{ctx: r.Context(), limiter: l.get(r), reader: reader}
+}
+
+type limitedWriter struct {
+	ctx     context.Context
+	limiter *rate.Limiter
+	writer  io.Writer
+}
+
+func (w *limitedWriter) Write(p []byte) (int, error) {
+	var written int
+	for len(p) > 0 {
+		chunk := p
+		if len(chunk) > w.limiter.Burst() {
+			chunk = chunk[:w.limiter.Burst()]
+		}
+		if err := w.limiter.WaitN(w.ctx, len(chunk)); err != nil {
+			return written, err
+		}
+		n, err := w.writer.Write(chunk)
+		written += n
+		if err != nil {
+			return written, err
+		}
+		p = p[n:]
+	}
+	return written, nil
+}
+
+type limitedReader struct {
+	ctx     context.Context
+	limiter *rate.Limiter
+	reader  io.Reader
+}
+
+func (r *limitedReader) Read(p []byte) (int, error) {
+	if len(p) > r.limiter.Burst() {
+		p = p[:r.limiter.Burst()]
+	}
+	n, err := r.reader.Read(p)
+	if n > 0 {
+		if waitErr := r.limiter.WaitN(r.ctx, n); waitErr != nil {
+			return n, waitErr
+		}
+	}
+	return n, err
+}
@@ -19,6 +19,7 @@ type HTMLReporter struct {
 	lastUpdate   time.Time
 	updateDelay  time.Duration
 	enableUnlock bool
+	enableSpeed  bool
 	fastMode     bool
 	configPath   string
 	totalCount   int
@@ -43,6 +44,7 @@ type Result struct {
 	PacketLossValue float64       // 丢包率值
 	Location        template.HTML // 地理位置
 	StreamUnlock    string        // 流媒体解锁
+	UnlockShared    string        // 复用解锁结果的来源节点
 	UnlockPlatforms []Platform    // 解锁平台列表
 	DownloadSpeed   string        // 下载速度
 	DownloadSpeedMB float64       // 下载速度值(MB/s)
@@ -55,6 +57,7 @@ type Result struct {
 type templateData struct {
 	Results      []*Result
 	EnableUnlock bool
+	EnableSpeed  bool
 	FastMode     bool
 	LastUpdate   time.Time
 	ConfigPath   string
@@ -156,6 +159,11 @@ const htmlTemplate = `
             color: white;
             border-radius: 4px;
         }
+        .platform-tag.shared {
+            background-color: #e9ecef;
+            color: #495057;
+            border: 1px dashed #adb5bd;
+        }
         .proxy-type {
             display: inline-block;
             padding: 2px 6px;
@@ -457,30 +465,22 @@ const htmlTemplate = `
             <table class="table table-hover">
                 <thead>
                     <tr>
-                        {{if .FastMode}}
-                        <th>序号</th>
-                        <th>名称</th>
-                        <th>协议</th>
-                        <th class="sortable" onclick="sortTable(3, 'number')">延迟</th>
-                        {{else if .EnableUnlock}}
-                        <th>序号</th>
-                        <th>名称</th>
-                        <th>协议</th>
-                        <th class="sortable" onclick="sortTable(3, 'number')">延迟</th>
-                        <th>抖动</th>
-                        <th>丢包率</th>
-                        <th>地理/风险</th>
-                        <th>流媒体</th>
-                        {{else}}
                         <th>序号</th>
                         <th>名称</th>
                         <th>协议</th>
                         <th class="sortable" onclick="sortTable(3, 'number')">延迟</th>
+                        {{if not .FastMode}}
                         <th>抖动</th>
                         <th>丢包率</th>
+                        {{if .EnableSpeed}}
                         <th class="sortable" onclick="sortTable(6, 'speed')">下载速度</th>
                         <th class="sortable" onclick="sortTable(7, 'speed')">上传速度</th>
                         {{end}}
+                        {{if .EnableUnlock}}
+                        <th>地理/风险</th>
+                        <th>流媒体</th>
+                        {{end}}
+                        {{end}}
                     </tr>
                 </thead>
                 <tbody id="results">
@@ -503,7 +503,6 @@ const htmlTemplate = `
                             {{end}}
                         </td>
                         {{if not $.FastMode}}
-                            {{if $.EnableUnlock}}
                             <td>
                                 {{if or (eq $result.Jitter "N/A") (eq $result.Jitter "0.00ms")}}
                                 <span class="unavailable-tag">{{$result.Jitter}}</span>
@@ -514,43 +513,38 @@ const htmlTemplate = `
                             <td>
                                 <span class="loss-tag" style="{{lossColor $result.PacketLossValue}}">{{$result.PacketLoss}}</span>
                             </td>
-                            <td>{{.Location}}</td>
+                            {{if $.EnableSpeed}}
                             <td>
                                 {{if or (eq $result.Latency "N/A") (eq $result.Latency "0.00ms")}}
-                                <span class="unavailable-tag">N/A</span>
-                                {{else}}
-                                {{if and $result.UnlockPlatforms (gt (len $result.UnlockPlatforms) 0)}}
-                                {{range $result.UnlockPlatforms}}
-                                <span class="platform-tag" style="{{randomColor .Name}}">{{.Name}} {{.Region}}</span>
-                                {{end}}
+                                <span class="unavailable-tag">{{$result.DownloadSpeed}}</span>
                                 {{else}}
-                                <span class="platform-tag na">N/A</span>
-                                {{end}}
+                                <span class="speed-tag {{getSpeedClass $result.DownloadSpeed}}">{{$result.DownloadSpeed}}</span>
                                 {{end}}
                             </td>
-                            {{else}}
                             <td>
-                                {{if or (eq $result.Jitter "N/A") (eq $result.Jitter "0.00ms")}}
-                                <span class="unavailable-tag">{{$result.Jitter}}</span>
+                                {{if or (eq $result.Latency "N/A") (eq $result.Latency "0.00ms")}}
+                                <span class="unavailable-tag">{{$result.UploadSpeed}}</span>
                                 {{else}}
-                                <span class="jitter-tag" style="{{jitterColor $result.JitterValue}}">{{$result.Jitter}}</span>
+                                <span class="speed-tag {{getSpeedClass $result.UploadSpeed}}">{{$result.UploadSpeed}}</span>
                                 {{end}}
                             </td>
-                            <td>
-                                <span class="loss-tag" style="{{lossColor $result.PacketLossValue}}">{{$result.PacketLoss}}</span>
-                            </td>
+                            {{end}}
+                            {{if $.EnableUnlock}}
+                            <td>{{.Location}}</td>
                             <td>
                                 {{if or (eq $result.Latency "N/A") (eq $result.Latency "0.00ms")}}
-                                <span class="unavailable-tag">{{$result.DownloadSpeed}}</span>
+                                <span class="unavailable-tag">N/A</span>
                                 {{else}}
-                                <span class="speed-tag {{getSpeedClass $result.DownloadSpeed}}">{{$result.DownloadSpeed}}</span>
+                                {{if $result.UnlockShared}}
+                                <span class="platform-tag shared" title="出口 IP 相同，复用该节点的检测结果">共享: {{$result.UnlockShared}}</span>
+                                {{end}}
+                                {{if and $result.UnlockPlatforms (gt (len $result.UnlockPlatforms) 0)}}
+                                {{range $result.UnlockPlatforms}}
+                                <span class="platform-tag" style="{{randomColor .Name}}">{{.Name}} {{.Region}}</span>
                                 {{end}}
-                            </td>
-                            <td>
-                                {{if or (eq $result.Latency "N/A") (eq $result.Latency "0.00ms")}}
-                                <span class="unavailable-tag">{{$result.UploadSpeed}}</span>
                                 {{else}}
-                                <span class="speed-tag {{getSpeedClass $result.UploadSpeed}}">{{$result.UploadSpeed}}</span>
+                                <span class="platform-tag na">N/A</span>
+                                {{end}}
                                 {{end}}
                             </td>
                             {{end}}
@@ -905,12 +899,14 @@ const htmlTemplate = `
 `
 
 // NewHTMLReporter creates a new HTML reporter
-func NewHTMLReporter(outputPath string, enableUnlock bool, configPath string, totalCount int, outputConfig string, fastMode bool) (*HTMLReporter, error) {
+// enableUnlock and enableSpeed select the unlock and speed columns, both may be enabled together
+func NewHTMLReporter(outputPath string, enableUnlock bool, enableSpeed bool, configPath string, totalCount int, outputConfig string, fastMode bool) (*HTMLReporter, error) {
 	reporter := &HTMLReporter{
 		Results:      make([]*Result, 0),
 		outputPath:   outputPath,
 		updateDelay:  time.Second * 2,
 		enableUnlock: enableUnlock,
+		enableSpeed:  enableSpeed,
 		fastMode:     fastMode,
 		configPath:   configPath,
 		totalCount:   totalCount,
@@ -955,6 +951,7 @@ func NewHTMLReporter(outputPath string, enableUnlock bool, configPath string, to
 	data := templateData{
 		Results:      reporter.Results,
 		EnableUnlock: reporter.enableUnlock,
+		EnableSpeed:  reporter.enableSpeed,
 		FastMode:     reporter.fastMode,
 		LastUpdate:   time.Now(),
 		ConfigPath:   reporter.configPath,
@@ -990,6 +987,7 @@ func (r *HTMLReporter) AddResult(result *Result) error {
 	data := templateData{
 		Results:      r.Results,
 		EnableUnlock: r.enableUnlock,
+		EnableSpeed:  r.enableSpeed,
 		FastMode:     r.fastMode,
 		LastUpdate:   r.lastUpdate,
 		ConfigPath:   r.configPath,
@@ -1005,56 +1003,47 @@ func (r *HTMLReporter) AddResult(result *Result) error {
 	return nil
 }
 
+// Risk 表示 IP 风险检测结果
+type Risk struct {
+	Score  float64 // 风险值
+	Type   string  // IP 类型
+	Proxy  bool    // 是否被识别为代理
+	VPN    bool    // 是否被识别为 VPN
+	Source string  // 检测服务
+}
+
 // FormatLocation formats location information
-func FormatLocation(location string) template.HTML {
-	if location == "N/A" {
-		return template.HTML(fmt.Sprintf(`<div class="location-container"><span class="location-tag bg-danger">%s</span></div>`, location))
+func FormatLocation(country string, risk *Risk) template.HTML {
+	country = strings.TrimSpace(country)
+	if country == "" || country == "N/A" {
+		return template.HTML(`<div class="location-container"><span class="location-tag bg-danger">N/A</span></div>`)
+	}
+	if risk == nil {
+		return template.HTML(fmt.Sprintf(`<div class="location-container"><span class="location-tag">%s</span></div>`, template.HTMLEscapeString(country)))
 	}
 
-	// 移除 ANSI 颜色代码
-	re := regexp.MustCompile(`\x1b\[[0-9;]*m`)
-	location = re.ReplaceAllString(location, "")
-
-	// 分离国家代码和风险值
-	parts := strings.Fields(location)
-	if len(parts) > 1 {
-		country := parts[0]
-		riskParts := strings.Split(strings.Trim(parts[1], "[]"), " ")
-		var riskValue string
-		if len(riskParts) >= 1 {
-			riskValue = riskParts[0]
-		}
-
-		// 根据风险值设置不同的颜色
-		var riskClass string
-		var riskText string
-
-		switch {
-		case riskValue == "0":
-			riskClass = "bg-success" // 纯净
-			riskText = fmt.Sprintf("%s 纯净", riskValue)
-		case riskValue == "100" || riskValue == "--":
-			riskClass = "bg-danger" // 非常差
-			riskText = fmt.Sprintf("%s 非常差", riskValue)
-		case riskValue == "":
-			riskClass = "bg-danger" // 未知
-			riskText = "未知"
-		default:
-			riskVal, _ := strconv.ParseFloat(riskValue, 64)
-			if riskVal < 66 {
-				riskClass = "bg-warning" // 一般
-				riskText = fmt.Sprintf("%s 一般", riskValue)
-			} else {
-				riskClass = "bg-danger" // 较差
-				riskText = fmt.Sprintf("%s 较差", riskValue)
-			}
-		}
-
-		return template.HTML(fmt.Sprintf(`<div class="location-container"><span class="location-tag">%s</span><span class="risk-tag %s">%s</span></div>`,
-			country, riskClass, riskText))
+	// 根据风险值设置不同的颜色
+	var riskClass string
+	var riskText string
+	switch {
+	case risk.Score == 0:
+		riskClass = "bg-success" // 纯净
+		riskText = "0 纯净"
+	case risk.Score >= 100:
+		riskClass = "bg-danger" // 非常差
+		riskText = fmt.Sprintf("%.0f 非常差", risk.Score)
+	case risk.Score < 66:
+		riskClass = "bg-warning" // 一般
+		riskText = fmt.Sprintf("%.0f 一般", risk.Score)
+	default:
+		riskClass = "bg-danger" // 较差
+		riskText = fmt.Sprintf("%.0f 较差", risk.Score)
 	}
 
-	return template.HTML(fmt.Sprintf(`<div class="location-container"><span class="location-tag">%s</span></div>`, strings.TrimSpace(location)))
+	// 悬停显示 IP 类型、代理标记和检测来源
+	title := fmt.Sprintf("类型: %s, 代理: %t, VPN: %t, 来源: %s", risk.Type, risk.Proxy, risk.VPN, risk.Source)
+	return template.HTML(fmt.Sprintf(`<div class="location-container"><span class="location-tag">%s</span><span class="risk-tag %s" title="%s">%s</span></div>`,
+		template.HTMLEscapeString(country), riskClass, template.HTMLEscapeString(title), riskText))
 }
 
 // ParseStreamUnlock parses stream unlock information
@@ -0,0 +1,52 @@
+package speedtester
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+)
+
+// download-server 返回的服务端字节统计
+const (
+	// BytesSentHeader 下载响应的 trailer，服务端实际发送的字节数
+	BytesSentHeader = "X-Bytes-Sent"
+	// BytesReceivedHeader 上传响应头，服务端实际收到的字节数
+	BytesReceivedHeader = "X-Bytes-Received"
+)
+
+// byteMismatchError 表示客户端统计的字节数与服务端不一致，请求本身已经完成
+type byteMismatchError struct {
+	server, client int64
+}
+
+func (e *byteMismatchError) Error() string {
+	return fmt.Sprintf("server counted %d bytes, client counted %d bytes", e.server, e.client)
+}
+
+// serverAccounting 返回是否可以使用服务端字节统计，只有 download-server 后端提供
+func (st *SpeedTester) serverAccounting() bool {
+	return st.config.Backend.Name() == BackendDownloadServer
+}
+
+// checkServerBytes 比较服务端在 header 中返回的字节数与客户端统计的字节数；
+// 下载的字节数在 trailer 中，经过不转发 trailer 的反向代理或 HTTP/1.0 时会丢失，此时无法比较
+func (st *SpeedTester) checkServerBytes(header http.Header, key string, client int64) error {
+	value := header.Get(key)
+	if value == "" {
+		if st.debugMode {
+			fmt.Printf("服务端没有返回 %s，跳过字节数校验\n", key)
+		}
+		return nil
+	}
+	server, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		if st.debugMode {
+			fmt.Printf("服务端返回的 %s 无效: %s\n", key, value)
+		}
+		return nil
+	}
+	if server != client {
+		return &byteMismatchError{server: server, client: client}
+	}
+	return nil
+}
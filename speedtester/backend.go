@@ -0,0 +1,217 @@
+package speedtester
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// 测速后端名称
+const (
+	BackendCloudflare     = "cloudflare"
+	BackendDownloadServer = "download-server"
+	BackendURL            = "url"
+	BackendLibreSpeed     = "librespeed"
+	BackendOokla          = "ookla"
+)
+
+// SpeedBackend 定义测速服务器的接口，负责构造延迟、下载和上传请求
+type SpeedBackend interface {
+	Name() string
+	// LatencyRequest 返回用于延迟测试的请求，响应应尽量小
+	LatencyRequest(ctx context.Context) (*http.Request, error)
+	// DownloadRequest 返回下载请求，服务器返回的数据可能多于或少于 size，超出部分不会读取
+	DownloadRequest(ctx context.Context, size int) (*http.Request, error)
+	// UploadRequest 返回上传 size 字节 body 的请求
+	UploadRequest(ctx context.Context, body io.Reader, size int) (*http.Request, error)
+	// SupportsUpload 表示后端是否支持上传测试
+	SupportsUpload() bool
+}
+
+// NewSpeedBackend 根据名称创建测速后端，serverURL 为测速服务器地址(url 后端为文件地址)，
+// token 不为空时所有请求携带 Authorization: Bearer <token>
+func NewSpeedBackend(name, serverURL, token string) (SpeedBackend, error) {
+	serverURL = strings.TrimSuffix(serverURL, "/")
+	if serverURL == "" {
+		return nil, fmt.Errorf("server url is required for backend %s", name)
+	}
+	var backend SpeedBackend
+	switch strings.ToLower(name) {
+	case BackendCloudflare, "":
+		backend = &cloudflareBackend{name: BackendCloudflare, baseURL: serverURL, latencyPath: "/__down?bytes=0"}
+	case BackendDownloadServer:
+		// 自带的 download-server 实现了与 Cloudflare 相同的接口，并提供专门的延迟测试接口
+		backend = &cloudflareBackend{name: BackendDownloadServer, baseURL: serverURL, latencyPath: "/__ping"}
+	case BackendURL:
+		backend = &urlBackend{fileURL: serverURL}
+	case BackendLibreSpeed:
+		backend = &libreSpeedBackend{baseURL: serverURL}
+	case BackendOokla:
+		backend = &ooklaBackend{baseURL: serverURL}
+	default:
+		return nil, fmt.Errorf("unknown speed backend: %s", name)
+	}
+	if token != "" {
+		backend = &tokenBackend{SpeedBackend: backend, token: token}
+	}
+	return backend, nil
+}
+
+// tokenBackend 为请求添加访问令牌
+type tokenBackend struct {
+	SpeedBackend
+	token string
+}
+
+func (b *tokenBackend) authorize(req *http.Request, err error) (*http.Request, error) {
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+b.token)
+	return req, nil
+}
+
+func (b *tokenBackend) LatencyRequest(ctx context.Context) (*http.Request, error) {
+	return b.authorize(b.SpeedBackend.LatencyRequest(ctx))
+}
+
+func (b *tokenBackend) DownloadRequest(ctx context.Context, size int) (*http.Request, error) {
+	return b.authorize(b.SpeedBackend.DownloadRequest(ctx, size))
+}
+
+func (b *tokenBackend) UploadRequest(ctx context.Context, body io.Reader, size int) (*http.Request, error) {
+	return b.authorize(b.SpeedBackend.UploadRequest(ctx, body, size))
+}
+
+func newUploadRequest(ctx context.Context, url string, body io.Reader, size int) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, "POST", url, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.ContentLength = int64(size)
+	return req, nil
+}
+
+// cloudflareBackend 使用 speed.cloudflare.com 的 /__down?bytes= 和 /__up 接口
+type cloudflareBackend struct {
+	name        string
+	baseURL     string
+	latencyPath string
+}
+
+func (b *cloudflareBackend) Name() string { return b.name }
+
+func (b *cloudflareBackend) LatencyRequest(ctx context.Context) (*http.Request, error) {
+	return http.NewRequestWithContext(ctx, "GET", b.baseURL+b.latencyPath, nil)
+}
+
+func (b *cloudflareBackend) DownloadRequest(ctx context.Context, size int) (*http.Request, error) {
+	return http.NewRequestWithContext(ctx, "GET", fmt.Sprintf("%s/__down?bytes=%d", b.baseURL, size), nil)
+}
+
+func (b *cloudflareBackend) UploadRequest(ctx context.Context, body io.Reader, size int) (*http.Request, error) {
+	return newUploadRequest(ctx, fmt.Sprintf("%s/__up", b.baseURL), body, size)
+}
+
+func (b *cloudflareBackend) SupportsUpload() bool { return true }
+
+// urlBackend 下载指定的文件，使用 Range 请求限制数据量，不支持上传
+type urlBackend struct {
+	fileURL string
+}
+
+func (b *urlBackend) Name() string { return BackendURL }
+
+func (b *urlBackend) LatencyRequest(ctx context.Context) (*http.Request, error) {
+	return http.NewRequestWithContext(ctx, "HEAD", b.fileURL, nil)
+}
+
+func (b *urlBackend) DownloadRequest(ctx context.Context, size int) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", b.fileURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=0-%d", size-1))
+	return req, nil
+}
+
+func (b *urlBackend) UploadRequest(ctx context.Context, body io.Reader, size int) (*http.Request, error) {
+	return nil, fmt.Errorf("backend %s does not support upload", BackendURL)
+}
+
+func (b *urlBackend) SupportsUpload() bool { return false }
+
+// libreSpeedBackend 使用 LibreSpeed 的 garbage.php 和 empty.php 接口
+type libreSpeedBackend struct {
+	baseURL string
+}
+
+func (b *libreSpeedBackend) Name() string { return BackendLibreSpeed }
+
+func (b *libreSpeedBackend) LatencyRequest(ctx context.Context) (*http.Request, error) {
+	return http.NewRequestWithContext(ctx, "GET", fmt.Sprintf("%s/empty.php", b.baseURL), nil)
+}
+
+// DownloadRequest garbage.php 按 1MiB 为单位返回数据，向上取整
+func (b *libreSpeedBackend) DownloadRequest(ctx context.Context, size int) (*http.Request, error) {
+	chunks := (size + 1024*1024 - 1) / (1024 * 1024)
+	if chunks < 1 {
+		chunks = 1
+	}
+	return http.NewRequestWithContext(ctx, "GET", fmt.Sprintf("%s/garbage.php?ckSize=%d", b.baseURL, chunks), nil)
+}
+
+func (b *libreSpeedBackend) UploadRequest(ctx context.Context, body io.Reader, size int) (*http.Request, error) {
+	return newUploadRequest(ctx, fmt.Sprintf("%s/empty.php", b.baseURL), body, size)
+}
+
+func (b *libreSpeedBackend) SupportsUpload() bool { return true }
+
+// ooklaBackend 使用 Ookla HTTP 测速服务器的 /speedtest/ 接口
+type ooklaBackend struct {
+	baseURL string
+}
+
+// ooklaImages Ookla 服务器提供的测速图片边长及其大致大小
+var ooklaImages = []struct {
+	side int
+	size int
+}{
+	{350, 245388},
+	{500, 505544},
+	{750, 1118012},
+	{1000, 1986284},
+	{1500, 4468241},
+	{2000, 7907740},
+	{2500, 12407926},
+	{3000, 17816816},
+	{3500, 24262167},
+	{4000, 31625365},
+}
+
+func (b *ooklaBackend) Name() string { return BackendOokla }
+
+func (b *ooklaBackend) LatencyRequest(ctx context.Context) (*http.Request, error) {
+	return http.NewRequestWithContext(ctx, "GET", fmt.Sprintf("%s/speedtest/latency.txt", b.baseURL), nil)
+}
+
+// DownloadRequest 选择不小于 size 的最小图片，超过最大图片时使用最大图片
+func (b *ooklaBackend) DownloadRequest(ctx context.Context, size int) (*http.Request, error) {
+	side := ooklaImages[len(ooklaImages)-1].side
+	for _, image := range ooklaImages {
+		if image.size >= size {
+			side = image.side
+			break
+		}
+	}
+	return http.NewRequestWithContext(ctx, "GET", fmt.Sprintf("%s/speedtest/random%dx%d.jpg", b.baseURL, side, side), nil)
+}
+
+func (b *ooklaBackend) UploadRequest(ctx context.Context, body io.Reader, size int) (*http.Request, error) {
+	return newUploadRequest(ctx, fmt.Sprintf("%s/speedtest/upload.php", b.baseURL), body, size)
+}
+
+func (b *ooklaBackend) SupportsUpload() bool { return true }
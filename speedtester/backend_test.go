@@ -0,0 +1,151 @@
+package speedtester
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestNewSpeedBackend(t *testing.T) {
+	tests := []struct {
+		backend  string
+		url      string
+		size     int
+		latency  string
+		download string
+		upload   string
+	}{
+		{
+			backend: BackendCloudflare, url: "https://speed.cloudflare.com/", size: 1000,
+			latency:  "GET https://speed.cloudflare.com/__down?bytes=0",
+			download: "GET https://speed.cloudflare.com/__down?bytes=1000",
+			upload:   "POST https://speed.cloudflare.com/__up",
+		},
+		{
+			backend: "", url: "https://speed.cloudflare.com", size: 1000,
+			latency:  "GET https://speed.cloudflare.com/__down?bytes=0",
+			download: "GET https://speed.cloudflare.com/__down?bytes=1000",
+			upload:   "POST https://speed.cloudflare.com/__up",
+		},
+		{
+			backend: "Download-Server", url: "http://1.2.3.4:8080", size: 1000,
+			latency:  "GET http://1.2.3.4:8080/__ping",
+			download: "GET http://1.2.3.4:8080/__down?bytes=1000",
+			upload:   "POST http://1.2.3.4:8080/__up",
+		},
+		{
+			backend: BackendURL, url: "https://example.com/file.bin", size: 1000,
+			latency:  "HEAD https://example.com/file.bin",
+			download: "GET https://example.com/file.bin",
+		},
+		{
+			backend: BackendLibreSpeed, url: "https://librespeed.example.com/backend/", size: 1024*1024 + 1,
+			latency:  "GET https://librespeed.example.com/backend/empty.php",
+			download: "GET https://librespeed.example.com/backend/garbage.php?ckSize=2",
+			upload:   "POST https://librespeed.example.com/backend/empty.php",
+		},
+		{
+			backend: BackendLibreSpeed, url: "https://librespeed.example.com/backend", size: 0,
+			latency:  "GET https://librespeed.example.com/backend/empty.php",
+			download: "GET https://librespeed.example.com/backend/garbage.php?ckSize=1",
+			upload:   "POST https://librespeed.example.com/backend/empty.php",
+		},
+		{
+			backend: BackendOokla, url: "http://speedtest.example.com:8080", size: 1000000,
+			latency:  "GET http://speedtest.example.com:8080/speedtest/latency.txt",
+			download: "GET http://speedtest.example.com:8080/speedtest/random750x750.jpg",
+			upload:   "POST http://speedtest.example.com:8080/speedtest/upload.php",
+		},
+		{
+			backend: BackendOokla, url: "http://speedtest.example.com:8080", size: 100 * 1024 * 1024,
+			latency:  "GET http://speedtest.example.com:8080/speedtest/latency.txt",
+			download: "GET http://speedtest.example.com:8080/speedtest/random4000x4000.jpg",
+			upload:   "POST http://speedtest.example.com:8080/speedtest/upload.php",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.backend+" "+tt.download, func(t *testing.T) {
+			backend, err := NewSpeedBackend(tt.backend, tt.url, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			ctx := context.Background()
+			checkRequest(t, "latency", tt.latency)(backend.LatencyRequest(ctx))
+			checkRequest(t, "download", tt.download)(backend.DownloadRequest(ctx, tt.size))
+
+			if backend.SupportsUpload() != (tt.upload != "") {
+				t.Fatalf("SupportsUpload() = %v", backend.SupportsUpload())
+			}
+			if tt.upload == "" {
+				if _, err := backend.UploadRequest(ctx, strings.NewReader(""), 0); err == nil {
+					t.Error("upload should fail")
+				}
+				return
+			}
+			req, err := backend.UploadRequest(ctx, strings.NewReader("data"), 4)
+			checkRequest(t, "upload", tt.upload)(req, err)
+			if req.ContentLength != 4 || req.Header.Get("Content-Type") != "application/octet-stream" {
+				t.Errorf("upload content length %d, type %q", req.ContentLength, req.Header.Get("Content-Type"))
+			}
+		})
+	}
+}
+
+func checkRequest(t *testing.T, kind, want string) func(*http.Request, error) {
+	return func(req *http.Request, err error) {
+		t.Helper()
+		if err != nil {
+			t.Fatalf("%s request: %v", kind, err)
+		}
+		if got := req.Method + " " + req.URL.String(); got != want {
+			t.Errorf("%s request = %s, want %s", kind, got, want)
+		}
+	}
+}
+
+func TestURLBackendRange(t *testing.T) {
+	backend, err := NewSpeedBackend(BackendURL, "https://example.com/file.bin", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, err := backend.DownloadRequest(context.Background(), 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := req.Header.Get("Range"); got != "bytes=0-999" {
+		t.Errorf("Range = %q, want bytes=0-999", got)
+	}
+}
+
+func TestSpeedBackendToken(t *testing.T) {
+	backend, err := NewSpeedBackend(BackendDownloadServer, "http://1.2.3.4:8080", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 设置令牌后仍保留后端名称，download-server 的字节数校验依赖该名称
+	if backend.Name() != BackendDownloadServer {
+		t.Errorf("Name() = %s, want %s", backend.Name(), BackendDownloadServer)
+	}
+	ctx := context.Background()
+	latency, _ := backend.LatencyRequest(ctx)
+	download, _ := backend.DownloadRequest(ctx, 10)
+	upload, _ := backend.UploadRequest(ctx, strings.NewReader("x"), 1)
+	for _, req := range []*http.Request{latency, download, upload} {
+		if got := req.Header.Get("Authorization"); got != "Bearer secret" {
+			t.Errorf("%s %s Authorization = %q", req.Method, req.URL, got)
+		}
+	}
+}
+
+func TestNewSpeedBackendErrors(t *testing.T) {
+	if _, err := NewSpeedBackend(BackendCloudflare, "", ""); err == nil {
+		t.Error("empty server url should fail")
+	}
+	if _, err := NewSpeedBackend(BackendCloudflare, "/", ""); err == nil {
+		t.Error("server url / should fail")
+	}
+	if _, err := NewSpeedBackend("fast.com", "https://fast.com", ""); err == nil {
+		t.Error("unknown backend should fail")
+	}
+}
@@ -0,0 +1,122 @@
+package speedtester
+
+import (
+	"context"
+	"net"
+	"net/netip"
+	"sync"
+
+	"github.com/metacubex/mihomo/component/dialer"
+	"github.com/metacubex/mihomo/constant"
+	"github.com/metacubex/mihomo/log"
+)
+
+// withDialOptions 返回设置了出口网卡的节点配置副本，interface-name 对所有节点类型的 TCP 和 UDP 连接都有效；
+// 节点已经指定网卡时保持不变
+func (st *SpeedTester) withDialOptions(config map[string]any) map[string]any {
+	if st.config.Interface == "" {
+		return config
+	}
+	if _, ok := config["interface-name"]; ok {
+		return config
+	}
+	boundConfig := make(map[string]any, len(config)+1)
+	for key, value := range config {
+		boundConfig[key] = value
+	}
+	boundConfig["interface-name"] = st.config.Interface
+	return boundConfig
+}
+
+// withProviderDialOptions 返回设置了出口网卡的 proxy-provider 配置副本，通过 override 对 provider 中的所有节点生效；
+// override 中已经指定网卡时保持不变
+func (st *SpeedTester) withProviderDialOptions(config map[string]any) map[string]any {
+	if st.config.Interface == "" {
+		return config
+	}
+	override := make(map[string]any)
+	if existing, ok := config["override"].(map[string]any); ok {
+		if _, ok := existing["interface-name"]; ok {
+			return config
+		}
+		for key, value := range existing {
+			override[key] = value
+		}
+	}
+	override["interface-name"] = st.config.Interface
+
+	boundConfig := make(map[string]any, len(config)+1)
+	for key, value := range config {
+		boundConfig[key] = value
+	}
+	boundConfig["override"] = override
+	return boundConfig
+}
+
+// boundProxy 支持自定义 dialer 的节点通过绑定了网卡和源地址的 mihomo dialer 建立连接
+type boundProxy struct {
+	constant.Proxy
+	dialer constant.Dialer
+}
+
+// sourceDialer 为 UDP 连接绑定源地址，mihomo dialer 的 WithNetDialer 只对 TCP 连接生效
+type sourceDialer struct {
+	constant.Dialer
+	source netip.Addr
+}
+
+func (d *sourceDialer) ListenPacket(ctx context.Context, network, address string, rAddrPort netip.AddrPort) (net.PacketConn, error) {
+	if address == "" {
+		address = netip.AddrPortFrom(d.source, 0).String()
+	}
+	return d.Dialer.ListenPacket(ctx, network, address, rAddrPort)
+}
+
+// dialOptions 返回绑定网卡和源地址的 mihomo dialer 选项
+func (st *SpeedTester) dialOptions() []dialer.Option {
+	var options []dialer.Option
+	if st.config.Interface != "" {
+		options = append(options, dialer.WithInterface(st.config.Interface))
+	}
+	if ip, err := netip.ParseAddr(st.config.SourceIP); err == nil {
+		options = append(options, dialer.WithNetDialer(&net.Dialer{LocalAddr: &net.TCPAddr{IP: ip.AsSlice()}}))
+	}
+	return options
+}
+
+// bindProxy 指定了源地址时包装节点，使节点到服务器的 TCP 和 UDP 连接都从该地址发出；
+// hysteria、hysteria2、wireguard、ssh、anytls 等节点不支持自定义 dialer，源地址对它们不生效
+func (st *SpeedTester) bindProxy(proxy constant.Proxy) constant.Proxy {
+	source, err := netip.ParseAddr(st.config.SourceIP)
+	if err != nil {
+		return proxy
+	}
+	return &boundProxy{Proxy: proxy, dialer: &sourceDialer{Dialer: dialer.NewDialer(st.dialOptions()...), source: source}}
+}
+
+// unboundTypes 已经提示过不支持绑定源地址的节点类型
+var unboundTypes sync.Map
+
+// warnUnbound 每种节点类型只提示一次源地址未生效
+func warnUnbound(proxyType constant.AdapterType) {
+	if _, loaded := unboundTypes.LoadOrStore(proxyType, true); !loaded {
+		log.Warnln("%s nodes do not support binding source ip, connecting with the default source address", proxyType)
+	}
+}
+
+// DialContext hysteria、wireguard 等节点不支持自定义 dialer，使用原节点连接，源地址不生效
+func (p *boundProxy) DialContext(ctx context.Context, metadata *constant.Metadata) (constant.Conn, error) {
+	if network := p.SupportWithDialer(); network != constant.ALLNet && network != constant.TCP {
+		warnUnbound(p.Type())
+		return p.Proxy.DialContext(ctx, metadata)
+	}
+	return p.DialContextWithDialer(ctx, p.dialer, metadata)
+}
+
+func (p *boundProxy) ListenPacketContext(ctx context.Context, metadata *constant.Metadata) (constant.PacketConn, error) {
+	if network := p.SupportWithDialer(); network != constant.ALLNet && network != constant.UDP {
+		warnUnbound(p.Type())
+		return p.Proxy.ListenPacketContext(ctx, metadata)
+	}
+	return p.ListenPacketWithDialer(ctx, p.dialer, metadata)
+}
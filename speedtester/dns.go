@@ -0,0 +1,212 @@
+package speedtester
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/metacubex/mihomo/component/dialer"
+	"github.com/metacubex/mihomo/constant"
+)
+
+// dnsLeakDomain ip-api 的 EDNS 检测服务，随机前缀的域名会由用户实际使用的 DNS 服务器解析，响应中返回该服务器的 IP
+const dnsLeakDomain = "edns.ip-api.com"
+
+// dohServers 用于检测 DoH 可用性的 DNS JSON API
+var dohServers = []struct {
+	Name string
+	URL  string
+}{
+	{"Cloudflare", "https://cloudflare-dns.com/dns-query?name=www.example.com&type=A"},
+	{"Google", "https://dns.google/resolve?name=www.example.com&type=A"},
+}
+
+// DNSResult 表示通过节点进行 DNS 检测的结果
+type DNSResult struct {
+	ResolveTime time.Duration `json:"resolve_time"` // 远端解析未缓存域名额外花费的时间
+	Resolver    string        `json:"resolver"`     // 解析域名的 DNS 服务器 IP
+	ResolverGeo string        `json:"resolver_geo"` // DNS 服务器所在地区和运营商
+	Leak        bool          `json:"leak"`         // 域名在本地而不是节点出口解析
+	DoH         []DoHResult   `json:"doh"`
+}
+
+// DoHResult 表示通过节点访问一个 DoH 服务器的结果
+type DoHResult struct {
+	Name    string        `json:"name"`
+	Latency time.Duration `json:"latency"` // 为 0 表示不可用
+}
+
+// Format 格式化为 解析 120ms 远端 DoH 2/2 形式
+func (r *DNSResult) Format() string {
+	var parts []string
+	switch {
+	case r.Resolver == "":
+		parts = append(parts, "解析失败")
+	case r.Leak:
+		parts = append(parts, fmt.Sprintf("解析 %s 本地(泄露)", formatLatency(r.ResolveTime)))
+	default:
+		parts = append(parts, fmt.Sprintf("解析 %s 远端", formatLatency(r.ResolveTime)))
+	}
+
+	reachable := 0
+	for _, doh := range r.DoH {
+		if doh.Latency > 0 {
+			reachable++
+		}
+	}
+	parts = append(parts, fmt.Sprintf("DoH %d/%d", reachable, len(r.DoH)))
+	return strings.Join(parts, " ")
+}
+
+// dnsResolverInfo ip-api EDNS 检测服务的响应
+type dnsResolverInfo struct {
+	DNS struct {
+		IP  string `json:"ip"`
+		Geo string `json:"geo"`
+	} `json:"dns"`
+}
+
+// testDNS 检测节点的远端解析耗时、是否在本地解析以及 DoH 可用性
+func (st *SpeedTester) testDNS(proxy constant.Proxy) *DNSResult {
+	result := &DNSResult{}
+	client := st.createClient(proxy)
+	client.Transport.(*http.Transport).DisableKeepAlives = true
+
+	// 第一次请求的域名没有被任何 DNS 服务器缓存，第二次请求同一个域名时已缓存，两者之差即为远端解析耗时
+	domain := fmt.Sprintf("%d%d.%s", time.Now().UnixNano(), rand.Intn(1000), dnsLeakDomain)
+	start := time.Now()
+	info, err := lookupResolver(client, domain)
+	uncached := time.Since(start)
+	if err != nil {
+		if st.debugMode {
+			fmt.Printf("DNS 检测失败: %v\n", err)
+		}
+	} else {
+		result.Resolver = info.DNS.IP
+		result.ResolverGeo = info.DNS.Geo
+
+		start = time.Now()
+		_, err := lookupResolver(client, domain)
+		if cached := time.Since(start); err == nil && uncached > cached {
+			result.ResolveTime = uncached - cached
+		}
+
+		result.Leak = isDNSLeak(st.localDNSResolver(), result.Resolver)
+	}
+
+	for _, server := range dohServers {
+		result.DoH = append(result.DoH, DoHResult{Name: server.Name, Latency: testDoH(client, server.URL)})
+	}
+	return result
+}
+
+// isDNSLeak 节点使用的 DNS 服务器与本机相同，说明域名在本地解析后才发给节点；本机 DNS 服务器未知时不判断为泄露
+func isDNSLeak(local, resolver string) bool {
+	if local == "" || resolver == "" {
+		return false
+	}
+	localIP, err1 := netip.ParseAddr(local)
+	resolverIP, err2 := netip.ParseAddr(resolver)
+	if err1 != nil || err2 != nil {
+		return local == resolver
+	}
+	return localIP.Unmap() == resolverIP.Unmap()
+}
+
+// localResolver 本机直接访问时使用的 DNS 服务器，只检测一次
+type localResolver struct {
+	once sync.Once
+	ip   string
+}
+
+// localDNSResolver 返回本机直接访问时使用的 DNS 服务器，与连接节点一样使用 -interface 和 -source-ip 指定的出口
+func (st *SpeedTester) localDNSResolver() string {
+	st.localResolver.once.Do(func() {
+		client := &http.Client{
+			Timeout: st.config.Timeout,
+			Transport: &http.Transport{
+				DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+					return dialer.DialContext(ctx, network, addr, st.dialOptions()...)
+				},
+			},
+		}
+		domain := fmt.Sprintf("%d%d.%s", time.Now().UnixNano(), rand.Intn(1000), dnsLeakDomain)
+		info, err := lookupResolver(client, domain)
+		if err != nil {
+			if st.debugMode {
+				fmt.Printf("检测本机 DNS 服务器失败: %v\n", err)
+			}
+			return
+		}
+		st.localResolver.ip = info.DNS.IP
+	})
+	return st.localResolver.ip
+}
+
+func lookupResolver(client *http.Client, domain string) (*dnsResolverInfo, error) {
+	resp, err := client.Get("http://" + domain + "/json")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	if err != nil {
+		return nil, err
+	}
+	info := &dnsResolverInfo{}
+	if err := json.Unmarshal(body, info); err != nil {
+		return nil, err
+	}
+	if info.DNS.IP == "" {
+		return nil, fmt.Errorf("no resolver in response")
+	}
+	return info, nil
+}
+
+// testDoH 通过节点发送一次 DoH 查询，返回耗时，失败时返回 0
+func testDoH(client *http.Client, url string) time.Duration {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return 0
+	}
+	req.Header.Set("Accept", "application/dns-json")
+
+	start := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0
+	}
+	defer resp.Body.Close()
+
+	var answer struct {
+		Status int `json:"Status"`
+	}
+	if resp.StatusCode != http.StatusOK || json.NewDecoder(io.LimitReader(resp.Body, 64*1024)).Decode(&answer) != nil {
+		return 0
+	}
+	// Status 为 DNS 响应码，0 表示 NOERROR
+	if answer.Status != 0 {
+		return 0
+	}
+	return time.Since(start)
+}
+
+// DNSColumn 显示 DNS 检测结果的列
+var DNSColumn = Column{Name: "dns", Header: "DNS", Value: func(r *Result) string {
+	if r.DNS == nil {
+		return "N/A"
+	}
+	return r.DNS.Format()
+}}
@@ -0,0 +1,40 @@
+package speedtester
+
+import "testing"
+
+func TestIsDNSLeak(t *testing.T) {
+	tests := []struct {
+		local    string
+		resolver string
+		want     bool
+	}{
+		{local: "8.8.8.8", resolver: "8.8.8.8", want: true},
+		{local: "8.8.8.8", resolver: "1.1.1.1", want: false},
+		{local: "", resolver: "8.8.8.8", want: false},
+		{local: "8.8.8.8", resolver: "", want: false},
+		{local: "::ffff:8.8.8.8", resolver: "8.8.8.8", want: true},
+		{local: "2001:4860:4860::8888", resolver: "2001:4860:4860:0:0:0:0:8888", want: true},
+		{local: "2001:4860:4860::8888", resolver: "2001:4860:4860::8844", want: false},
+	}
+	for _, tt := range tests {
+		if got := isDNSLeak(tt.local, tt.resolver); got != tt.want {
+			t.Errorf("isDNSLeak(%q, %q) = %v, want %v", tt.local, tt.resolver, got, tt.want)
+		}
+	}
+}
+
+func TestDNSResultFormat(t *testing.T) {
+	tests := []struct {
+		result DNSResult
+		want   string
+	}{
+		{result: DNSResult{}, want: "解析失败 DoH 0/0"},
+		{result: DNSResult{Resolver: "1.1.1.1", ResolveTime: 120e6, DoH: []DoHResult{{Latency: 1}, {}}}, want: "解析 120ms 远端 DoH 1/2"},
+		{result: DNSResult{Resolver: "1.1.1.1", Leak: true, ResolveTime: 120e6}, want: "解析 120ms 本地(泄露) DoH 0/0"},
+	}
+	for _, tt := range tests {
+		if got := tt.result.Format(); got != tt.want {
+			t.Errorf("Format() = %q, want %q", got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,192 @@
+package speedtester
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/faceair/clash-speedtest/unlock"
+	"github.com/metacubex/mihomo/constant"
+)
+
+// 只能通过 IPv4 或 IPv6 访问的 Cloudflare trace 地址，使用 IP 避免依赖远端解析
+const (
+	exitIPv4TraceURL = "https://1.1.1.1/cdn-cgi/trace"
+	exitIPv6TraceURL = "https://[2606:4700:4700::1111]/cdn-cgi/trace"
+)
+
+// testExitIP 分别通过 IPv4 和 IPv6 地址访问 Cloudflare trace，获取节点的出口 IPv4 和 IPv6 地址
+func (st *SpeedTester) testExitIP(proxy constant.Proxy) (ipv4, ipv6 string) {
+	client := st.createDirectIPClient(proxy)
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		ipv4 = st.traceExitIP(client, exitIPv4TraceURL)
+	}()
+	go func() {
+		defer wg.Done()
+		ipv6 = st.traceExitIP(client, exitIPv6TraceURL)
+	}()
+	wg.Wait()
+	return ipv4, ipv6
+}
+
+func (st *SpeedTester) traceExitIP(client *http.Client, url string) string {
+	resp, err := client.Get(url)
+	if err != nil {
+		if st.debugMode {
+			fmt.Printf("获取出口 IP 失败 %s: %v\n", url, err)
+		}
+		return ""
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	if err != nil || resp.StatusCode != http.StatusOK {
+		if st.debugMode {
+			fmt.Printf("获取出口 IP 失败 %s: status %d, %v\n", url, resp.StatusCode, err)
+		}
+		return ""
+	}
+	ip, err := netip.ParseAddr(unlock.ParseTrace(body)["ip"])
+	if err != nil {
+		return ""
+	}
+	return ip.Unmap().String()
+}
+
+// createDirectIPClient 与 createClient 相同，但目标为 IP 地址时直接填入 DstIP，避免节点把 IP 当作域名解析
+func (st *SpeedTester) createDirectIPClient(proxy constant.Proxy) *http.Client {
+	return &http.Client{
+		Timeout: st.config.Timeout,
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+				host, port, err := net.SplitHostPort(addr)
+				if err != nil {
+					return nil, err
+				}
+				var u16Port uint16
+				if port, err := strconv.ParseUint(port, 10, 16); err == nil {
+					u16Port = uint16(port)
+				}
+				metadata := &constant.Metadata{DstPort: u16Port}
+				if ip, err := netip.ParseAddr(host); err == nil {
+					metadata.DstIP = ip
+				} else {
+					metadata.Host = host
+				}
+				return proxy.DialContext(ctx, metadata)
+			},
+		},
+	}
+}
+
+// ExitGroup 出口 IP 相同的一组节点
+type ExitGroup struct {
+	ID      int
+	Key     string
+	Results []*Result // 按表现从好到坏排列，第一个为保留的节点
+}
+
+// exitGroupKey 优先使用出口 IPv4 分组，没有 IPv4 出口时使用 IPv6
+func exitGroupKey(result *Result) string {
+	if result.ExitIPv4 != "" {
+		return result.ExitIPv4
+	}
+	return result.ExitIPv6
+}
+
+// betterResult 判断 a 是否比 b 表现更好：先比较下载速度，速度相同时(例如只测试延迟)比较延迟
+func betterResult(a, b *Result) bool {
+	if a.Reachable() != b.Reachable() {
+		return a.Reachable()
+	}
+	if a.DownloadSpeed != b.DownloadSpeed {
+		return a.DownloadSpeed > b.DownloadSpeed
+	}
+	return a.Latency < b.Latency
+}
+
+// GroupByExitIP 将出口 IP 相同的节点分组，每组保留表现最好的节点，其余节点标记为重复；
+// 只返回包含多个节点的组，没有检测到出口 IP 的节点不参与分组
+func GroupByExitIP(results []*Result) []*ExitGroup {
+	var groups []*ExitGroup
+	index := make(map[string]*ExitGroup)
+	for _, result := range results {
+		key := exitGroupKey(result)
+		if key == "" {
+			continue
+		}
+		group, ok := index[key]
+		if !ok {
+			group = &ExitGroup{Key: key}
+			index[key] = group
+			groups = append(groups, group)
+		}
+		group.Results = append(group.Results, result)
+	}
+
+	var duplicated []*ExitGroup
+	for _, group := range groups {
+		if len(group.Results) < 2 {
+			continue
+		}
+		group.ID = len(duplicated) + 1
+		// 稳定排序，表现相同时保留先出现的节点
+		sort.SliceStable(group.Results, func(i, j int) bool {
+			return betterResult(group.Results[i], group.Results[j])
+		})
+		best := group.Results[0]
+		for _, result := range group.Results {
+			result.ExitGroup = group.ID
+			result.ExitGroupSize = len(group.Results)
+			result.Duplicate = result != best
+		}
+		duplicated = append(duplicated, group)
+	}
+	return duplicated
+}
+
+// FormatExitIP 返回出口 IPv4 和 IPv6 地址，每行一个
+func (r *Result) FormatExitIP() string {
+	var lines []string
+	if r.ExitIPv4 != "" {
+		lines = append(lines, r.ExitIPv4)
+	}
+	if r.ExitIPv6 != "" {
+		lines = append(lines, r.ExitIPv6)
+	}
+	if len(lines) == 0 {
+		return "N/A"
+	}
+	return strings.Join(lines, "\n")
+}
+
+// FormatExitGroup 返回节点所在的出口分组，例如 组2(3个) 保留
+func (r *Result) FormatExitGroup() string {
+	if r.ExitGroup == 0 {
+		return ""
+	}
+	status := "保留"
+	if r.Duplicate {
+		status = "重复"
+	}
+	return fmt.Sprintf("组%d(%d个) %s", r.ExitGroup, r.ExitGroupSize, status)
+}
+
+// ExitIPColumn 显示节点的出口 IP 和出口分组
+var ExitIPColumn = Column{Name: "exit", Header: "出口IP", Value: func(r *Result) string {
+	if group := r.FormatExitGroup(); group != "" {
+		return r.FormatExitIP() + "\n" + group
+	}
+	return r.FormatExitIP()
+}}
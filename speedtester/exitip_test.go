@@ -0,0 +1,104 @@
+package speedtester
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBetterResult(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b Result
+		want bool
+	}{
+		{name: "faster", a: Result{Latency: 200, DownloadSpeed: 2000}, b: Result{Latency: 100, DownloadSpeed: 1000}, want: true},
+		{name: "slower", a: Result{Latency: 100, DownloadSpeed: 1000}, b: Result{Latency: 200, DownloadSpeed: 2000}, want: false},
+		// 速度相同时比较延迟
+		{name: "same speed lower latency", a: Result{Latency: 100}, b: Result{Latency: 200}, want: true},
+		{name: "same speed higher latency", a: Result{Latency: 200}, b: Result{Latency: 100}, want: false},
+		{name: "equal", a: Result{Latency: 100, DownloadSpeed: 1000}, b: Result{Latency: 100, DownloadSpeed: 1000}, want: false},
+		// 不可达的节点总是更差，即使下载速度更高
+		{name: "reachable", a: Result{Latency: 300}, b: Result{DownloadSpeed: 1000}, want: true},
+		{name: "all packets lost", a: Result{Latency: 100, PacketLoss: 100, DownloadSpeed: 1000}, b: Result{Latency: 300}, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := betterResult(&tt.a, &tt.b); got != tt.want {
+				t.Errorf("betterResult() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGroupByExitIP(t *testing.T) {
+	ms := time.Millisecond
+	results := []*Result{
+		{ProxyName: "a", ExitIPv4: "1.1.1.1", Latency: 100 * ms, DownloadSpeed: 1000},
+		{ProxyName: "b", ExitIPv4: "2.2.2.2", Latency: 100 * ms},
+		{ProxyName: "c", ExitIPv4: "1.1.1.1", ExitIPv6: "2001:db8::1", Latency: 300 * ms, DownloadSpeed: 3000},
+		{ProxyName: "d", ExitIPv6: "2001:db8::1", Latency: 200 * ms},
+		{ProxyName: "e", Latency: 100 * ms},
+		{ProxyName: "f", ExitIPv4: "1.1.1.1", Latency: 50 * ms, DownloadSpeed: 1000},
+		{ProxyName: "g", ExitIPv6: "2001:db8::1", Latency: 200 * ms},
+		{ProxyName: "h"},
+	}
+	groups := GroupByExitIP(results)
+
+	// 有 IPv4 出口的节点按 IPv4 分组，c 不会进入 IPv6 组；只有一个节点的 2.2.2.2 和没有出口 IP 的节点不分组
+	want := []struct {
+		key   string
+		names []string
+	}{
+		{key: "1.1.1.1", names: []string{"c", "f", "a"}},
+		{key: "2001:db8::1", names: []string{"d", "g"}},
+	}
+	if len(groups) != len(want) {
+		t.Fatalf("got %d groups, want %d", len(groups), len(want))
+	}
+	for i, group := range groups {
+		if group.ID != i+1 || group.Key != want[i].key {
+			t.Errorf("group %d = %d %s, want %d %s", i, group.ID, group.Key, i+1, want[i].key)
+		}
+		var names []string
+		for _, result := range group.Results {
+			names = append(names, result.ProxyName)
+		}
+		if len(names) != len(want[i].names) {
+			t.Fatalf("group %s = %v, want %v", group.Key, names, want[i].names)
+		}
+		for j := range names {
+			if names[j] != want[i].names[j] {
+				t.Errorf("group %s = %v, want %v", group.Key, names, want[i].names)
+				break
+			}
+		}
+	}
+
+	tests := []struct {
+		name      string
+		group     int
+		size      int
+		duplicate bool
+	}{
+		{name: "a", group: 1, size: 3, duplicate: true},
+		{name: "b"},
+		{name: "c", group: 1, size: 3},
+		// 速度和延迟都相同时保留先出现的节点
+		{name: "d", group: 2, size: 2},
+		{name: "e"},
+		{name: "f", group: 1, size: 3, duplicate: true},
+		{name: "g", group: 2, size: 2, duplicate: true},
+		{name: "h"},
+	}
+	for i, tt := range tests {
+		r := results[i]
+		if r.ProxyName != tt.name || r.ExitGroup != tt.group || r.ExitGroupSize != tt.size || r.Duplicate != tt.duplicate {
+			t.Errorf("%s: group %d size %d duplicate %v, want %d %d %v",
+				r.ProxyName, r.ExitGroup, r.ExitGroupSize, r.Duplicate, tt.group, tt.size, tt.duplicate)
+		}
+	}
+
+	if groups := GroupByExitIP(results[:2]); len(groups) != 0 {
+		t.Errorf("distinct exits should not be grouped, got %d groups", len(groups))
+	}
+}
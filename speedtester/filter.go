@@ -0,0 +1,330 @@
+package speedtester
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/metacubex/mihomo/constant"
+)
+
+// typeAliases 配置文件中与适配器类型名称不同的协议名称
+var typeAliases = map[string]string{
+	"ss":  "shadowsocks",
+	"ssr": "shadowsocksr",
+	"hy":  "hysteria",
+	"hy2": "hysteria2",
+}
+
+// tlsTypes 始终使用 TLS 的协议
+var tlsTypes = map[constant.AdapterType]bool{
+	constant.Trojan:    true,
+	constant.Hysteria:  true,
+	constant.Hysteria2: true,
+	constant.Tuic:      true,
+	constant.AnyTLS:    true,
+}
+
+// quicTypes 基于 QUIC 的协议
+var quicTypes = map[constant.AdapterType]bool{
+	constant.Hysteria:  true,
+	constant.Hysteria2: true,
+	constant.Tuic:      true,
+}
+
+// NodeFilter 按协议类型、服务器、端口、传输方式和 TLS 筛选节点，各条件同时满足时节点才会被测试
+type NodeFilter struct {
+	Types      []string       // 协议类型，如 vless,hysteria2
+	Hosts      []string       // 服务器域名，.example.com 匹配 example.com 及所有子域名
+	Prefixes   []netip.Prefix // 服务器 IP 网段
+	Ports      []portRange
+	Transports []string // 传输方式，如 ws,grpc,reality
+	TLS        *bool
+}
+
+type portRange struct {
+	from, to uint16
+}
+
+// ParseNodeFilter 解析节点筛选条件，所有参数都为空时返回 nil
+//   - types: 逗号分隔的协议类型，如 vless,hysteria2,url-test
+//   - servers: 逗号分隔的服务器域名、IP 或 CIDR，如 example.com,.example.net,10.0.0.0/8，
+//     .example.net、+.example.net 和 *.example.net 都匹配 example.net 及其所有子域名
+//   - ports: 逗号分隔的端口或端口范围，如 443,8000-9000
+//   - transports: 逗号分隔的传输方式，可选 tcp,ws,grpc,h2,http,quic,reality
+//   - tls: on 或 off
+func ParseNodeFilter(types, servers, ports, transports, tls string) (*NodeFilter, error) {
+	filter := &NodeFilter{}
+	for _, name := range splitLower(types) {
+		filter.Types = append(filter.Types, normalizeType(name))
+	}
+
+	for _, server := range splitLower(servers) {
+		if prefix, err := netip.ParsePrefix(server); err == nil {
+			filter.Prefixes = append(filter.Prefixes, prefix.Masked())
+		} else if ip, err := netip.ParseAddr(server); err == nil {
+			filter.Prefixes = append(filter.Prefixes, netip.PrefixFrom(ip, ip.BitLen()))
+		} else if strings.Contains(server, "/") {
+			return nil, fmt.Errorf("invalid server cidr: %s", server)
+		} else {
+			filter.Hosts = append(filter.Hosts, strings.TrimLeft(server, "*+"))
+		}
+	}
+
+	for _, value := range splitLower(ports) {
+		from, to, isRange := strings.Cut(value, "-")
+		if !isRange {
+			to = from
+		}
+		start, err := strconv.ParseUint(strings.TrimSpace(from), 10, 16)
+		if err != nil {
+			return nil, fmt.Errorf("invalid port: %s", value)
+		}
+		end, err := strconv.ParseUint(strings.TrimSpace(to), 10, 16)
+		if err != nil || end < start {
+			return nil, fmt.Errorf("invalid port range: %s", value)
+		}
+		filter.Ports = append(filter.Ports, portRange{from: uint16(start), to: uint16(end)})
+	}
+
+	for _, transport := range splitLower(transports) {
+		switch transport {
+		case "tcp", "ws", "grpc", "h2", "http", "quic", "reality":
+			filter.Transports = append(filter.Transports, transport)
+		default:
+			return nil, fmt.Errorf("unknown transport: %s", transport)
+		}
+	}
+
+	switch strings.ToLower(strings.TrimSpace(tls)) {
+	case "":
+	case "on", "true":
+		enabled := true
+		filter.TLS = &enabled
+	case "off", "false":
+		enabled := false
+		filter.TLS = &enabled
+	default:
+		return nil, fmt.Errorf("invalid tls filter: %s", tls)
+	}
+
+	if len(filter.Types) == 0 && len(filter.Hosts) == 0 && len(filter.Prefixes) == 0 &&
+		len(filter.Ports) == 0 && len(filter.Transports) == 0 && filter.TLS == nil {
+		return nil, nil
+	}
+	return filter, nil
+}
+
+// Check 返回节点不满足的筛选条件，满足所有条件时返回空字符串；来自 proxy-provider 的节点没有原始配置，
+// 传输方式和 TLS 从适配器解析后的选项中获取
+func (f *NodeFilter) Check(proxy *CProxy) string {
+	if f == nil {
+		return ""
+	}
+	config := nodeConfig(proxy)
+	if config == nil {
+		config = adapterConfig(proxy)
+	}
+
+	if len(f.Types) > 0 && !f.matchType(proxy, config) {
+		return "不满足 -type"
+	}
+
+	host, port := splitAddr(proxy.Addr())
+	if (len(f.Hosts) > 0 || len(f.Prefixes) > 0) && !f.matchServer(host) {
+		return "不满足 -server"
+	}
+	if len(f.Ports) > 0 && !f.matchPort(port) {
+		return "不满足 -port"
+	}
+
+	if len(f.Transports) > 0 {
+		if config == nil {
+			return "无法判断传输方式"
+		}
+		transport := nodeTransport(proxy.Type(), config)
+		found := false
+		for _, t := range f.Transports {
+			if t == transport || (t == "reality" && config["reality-opts"] != nil) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return "不满足 -transport"
+		}
+	}
+
+	if f.TLS != nil {
+		enabled, known := nodeTLS(proxy.Type(), config)
+		if !known {
+			return "无法判断 TLS"
+		}
+		if enabled != *f.TLS {
+			return "不满足 -tls"
+		}
+	}
+	return ""
+}
+
+func (f *NodeFilter) matchType(proxy *CProxy, config map[string]any) bool {
+	adapterType := strings.ToLower(proxy.Type().String())
+	configType, _ := config["type"].(string)
+	for _, name := range f.Types {
+		if name == adapterType || name == normalizeType(configType) {
+			return true
+		}
+	}
+	return false
+}
+
+func (f *NodeFilter) matchServer(host string) bool {
+	if ip, err := netip.ParseAddr(host); err == nil {
+		ip = ip.Unmap()
+		for _, prefix := range f.Prefixes {
+			if prefix.Contains(ip) {
+				return true
+			}
+		}
+		return false
+	}
+	host = strings.ToLower(host)
+	for _, pattern := range f.Hosts {
+		if host == pattern || (strings.HasPrefix(pattern, ".") && (strings.HasSuffix(host, pattern) || host == pattern[1:])) {
+			return true
+		}
+	}
+	return false
+}
+
+func (f *NodeFilter) matchPort(port uint16) bool {
+	for _, r := range f.Ports {
+		if port >= r.from && port <= r.to {
+			return true
+		}
+	}
+	return false
+}
+
+// nodeConfig 返回节点自身的原始配置，proxy-provider 中的节点记录的是 provider 的配置，返回 nil
+func nodeConfig(proxy *CProxy) map[string]any {
+	if name, _ := proxy.Config["name"].(string); name == proxy.Name() {
+		return proxy.Config
+	}
+	return nil
+}
+
+// adapterConfig 从适配器解析后的选项中还原 network、tls、reality-opts 和 plugin，
+// 选项是 mihomo 适配器的未导出字段，按 proxy 标签读取，无法读取时返回 nil
+func adapterConfig(proxy *CProxy) map[string]any {
+	option := adapterOption(reflect.ValueOf(proxy.Adapter()))
+	if !option.IsValid() {
+		return nil
+	}
+
+	config := make(map[string]any)
+	for i := 0; i < option.NumField(); i++ {
+		key, _, _ := strings.Cut(option.Type().Field(i).Tag.Get("proxy"), ",")
+		field := option.Field(i)
+		switch {
+		case (key == "network" || key == "plugin") && field.Kind() == reflect.String && field.String() != "":
+			config[key] = field.String()
+		case key == "tls" && field.Kind() == reflect.Bool:
+			config[key] = field.Bool()
+		case key == "reality-opts" && !field.IsZero():
+			config[key] = true
+		}
+	}
+	return config
+}
+
+// adapterOption 返回适配器的 option 字段，适配器被 autoCloseProxyAdapter 等包装时沿嵌入的 ProxyAdapter 查找
+func adapterOption(value reflect.Value) reflect.Value {
+	for depth := 0; depth < 4; depth++ {
+		for value.Kind() == reflect.Interface || value.Kind() == reflect.Pointer {
+			if value.IsNil() {
+				return reflect.Value{}
+			}
+			value = value.Elem()
+		}
+		if value.Kind() != reflect.Struct {
+			return reflect.Value{}
+		}
+		if option := value.FieldByName("option"); option.Kind() == reflect.Pointer && !option.IsNil() && option.Elem().Kind() == reflect.Struct {
+			return option.Elem()
+		}
+		value = value.FieldByName("ProxyAdapter")
+	}
+	return reflect.Value{}
+}
+
+// nodeTransport 返回节点的传输方式，没有设置 network 的节点为 tcp，基于 QUIC 的协议为 quic
+func nodeTransport(proxyType constant.AdapterType, config map[string]any) string {
+	if quicTypes[proxyType] {
+		return "quic"
+	}
+	if network, ok := config["network"].(string); ok && network != "" {
+		return strings.ToLower(network)
+	}
+	return "tcp"
+}
+
+// nodeTLS 返回节点是否使用 TLS，以及能否判断
+func nodeTLS(proxyType constant.AdapterType, config map[string]any) (bool, bool) {
+	if tlsTypes[proxyType] {
+		return true, true
+	}
+	if config == nil {
+		return false, false
+	}
+	if config["reality-opts"] != nil {
+		return true, true
+	}
+	if plugin, _ := config["plugin"].(string); plugin == "shadow-tls" {
+		return true, true
+	}
+	enabled, _ := config["tls"].(bool)
+	return enabled, true
+}
+
+func normalizeType(name string) string {
+	name = strings.ReplaceAll(strings.ToLower(name), "-", "")
+	if alias, ok := typeAliases[name]; ok {
+		return alias
+	}
+	return name
+}
+
+func splitAddr(addr string) (string, uint16) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr, 0
+	}
+	p, _ := strconv.ParseUint(port, 10, 16)
+	return host, uint16(p)
+}
+
+func splitLower(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.ToLower(strings.TrimSpace(item)); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// testableType 返回该类型的节点是否参与测试，内置策略和 select 代理组不测试，
+// url-test/fallback/load-balance 代理组只在启用代理组测试时参与
+func (st *SpeedTester) testableType(proxyType constant.AdapterType) bool {
+	switch proxyType {
+	case constant.Direct, constant.Reject, constant.RejectDrop, constant.Compatible, constant.Pass, constant.Dns, constant.Selector:
+		return false
+	case constant.URLTest, constant.Fallback, constant.LoadBalance:
+		return st.config.TestGroups
+	}
+	return true
+}
@@ -0,0 +1,177 @@
+package speedtester
+
+import (
+	"testing"
+
+	"github.com/metacubex/mihomo/adapter"
+)
+
+func TestParseNodeFilter(t *testing.T) {
+	tests := []struct {
+		name      string
+		types     string
+		servers   string
+		ports     string
+		transport string
+		tls       string
+		wantErr   bool
+		wantNil   bool
+	}{
+		{name: "empty", wantNil: true},
+		{name: "blank items", types: " , ", servers: ",", wantNil: true},
+		{name: "types", types: "ss,hy2,Vless"},
+		{name: "port range", ports: "443, 8000-9000"},
+		{name: "single port", ports: "65535"},
+		{name: "port out of range", ports: "65536", wantErr: true},
+		{name: "port not number", ports: "https", wantErr: true},
+		{name: "reversed range", ports: "9000-8000", wantErr: true},
+		{name: "cidr", servers: "10.0.0.0/8,2001:db8::/32"},
+		{name: "invalid cidr", servers: "10.0.0.0/33", wantErr: true},
+		{name: "unknown transport", transport: "kcp", wantErr: true},
+		{name: "tls on", tls: "on"},
+		{name: "tls false", tls: "FALSE"},
+		{name: "invalid tls", tls: "maybe", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filter, err := ParseNodeFilter(tt.types, tt.servers, tt.ports, tt.transport, tt.tls)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && (filter == nil) != tt.wantNil {
+				t.Errorf("filter = %v, wantNil %v", filter, tt.wantNil)
+			}
+		})
+	}
+}
+
+func TestParseNodeFilterValues(t *testing.T) {
+	filter, err := ParseNodeFilter("ss,hy2,Hysteria-2", "*.Example.com,+.example.net,1.2.3.4", "80,8000-9000", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantTypes := []string{"shadowsocks", "hysteria2", "hysteria2"}
+	for i, want := range wantTypes {
+		if filter.Types[i] != want {
+			t.Errorf("type %d = %s, want %s", i, filter.Types[i], want)
+		}
+	}
+	wantHosts := []string{".example.com", ".example.net"}
+	for i, want := range wantHosts {
+		if filter.Hosts[i] != want {
+			t.Errorf("host %d = %s, want %s", i, filter.Hosts[i], want)
+		}
+	}
+	if len(filter.Prefixes) != 1 || filter.Prefixes[0].String() != "1.2.3.4/32" {
+		t.Errorf("prefixes = %v, want [1.2.3.4/32]", filter.Prefixes)
+	}
+	if len(filter.Ports) != 2 || filter.Ports[1] != (portRange{from: 8000, to: 9000}) {
+		t.Errorf("ports = %v", filter.Ports)
+	}
+}
+
+func testProxy(t *testing.T, config map[string]any) *CProxy {
+	t.Helper()
+	proxy, err := adapter.ParseProxy(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &CProxy{Proxy: proxy, Config: config}
+}
+
+func TestNodeFilterCheck(t *testing.T) {
+	ss := map[string]any{"name": "ss", "type": "ss", "server": "a.example.com", "port": 8388, "cipher": "aes-128-gcm", "password": "x"}
+	vmessWS := map[string]any{"name": "vmess", "type": "vmess", "server": "10.1.2.3", "port": 443, "uuid": "b831381d-6324-4d53-ad4f-8cda48b30811", "cipher": "auto", "alterId": 0, "network": "ws", "tls": true}
+	vlessReality := map[string]any{"name": "vless", "type": "vless", "server": "example.com", "port": 443, "uuid": "b831381d-6324-4d53-ad4f-8cda48b30811",
+		"network": "tcp", "servername": "www.example.com", "reality-opts": map[string]any{"public-key": "CrrQSjAG_YkHLwvM2M-7XkKJilgL5upBKCp0od0tLhE"}}
+	hy2 := map[string]any{"name": "hy2", "type": "hysteria2", "server": "::ffff:192.168.1.1", "port": 8443, "password": "x"}
+
+	tests := []struct {
+		name    string
+		config  map[string]any
+		types   string
+		servers string
+		ports   string
+		network string
+		tls     string
+		want    string
+	}{
+		{name: "type alias ss", config: ss, types: "ss", want: ""},
+		{name: "type alias hy2", config: hy2, types: "hy2", want: ""},
+		{name: "type mismatch", config: ss, types: "vmess", want: "不满足 -type"},
+		{name: "subdomain", config: ss, servers: ".example.com", want: ""},
+		{name: "apex", config: vlessReality, servers: ".example.com", want: ""},
+		{name: "other domain", config: ss, servers: "example.com", want: "不满足 -server"},
+		{name: "cidr", config: vmessWS, servers: "10.0.0.0/8", want: ""},
+		{name: "ipv4 mapped in cidr", config: hy2, servers: "192.168.0.0/16", want: ""},
+		{name: "domain with cidr filter", config: ss, servers: "10.0.0.0/8", want: "不满足 -server"},
+		{name: "port in range", config: ss, ports: "8000-9000", want: ""},
+		{name: "port out of range", config: vmessWS, ports: "8000-9000", want: "不满足 -port"},
+		{name: "ws transport", config: vmessWS, network: "ws", want: ""},
+		{name: "default tcp", config: ss, network: "tcp", want: ""},
+		{name: "quic transport", config: hy2, network: "quic", want: ""},
+		{name: "reality transport", config: vlessReality, network: "reality", want: ""},
+		{name: "transport mismatch", config: ss, network: "grpc", want: "不满足 -transport"},
+		{name: "tls on", config: vmessWS, tls: "on", want: ""},
+		{name: "reality is tls", config: vlessReality, tls: "on", want: ""},
+		{name: "always tls", config: hy2, tls: "off", want: "不满足 -tls"},
+		{name: "tls off", config: ss, tls: "off", want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filter, err := ParseNodeFilter(tt.types, tt.servers, tt.ports, tt.network, tt.tls)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := filter.Check(testProxy(t, tt.config)); got != tt.want {
+				t.Errorf("Check() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// proxy-provider 中的节点记录的是 provider 的配置，传输方式和 TLS 从适配器中获取
+func TestNodeFilterCheckProviderNode(t *testing.T) {
+	providerConfig := map[string]any{"name": "sub", "type": "http", "url": "https://example.com/sub"}
+	tests := []struct {
+		name    string
+		config  map[string]any
+		network string
+		tls     string
+		want    string
+	}{
+		{
+			name:    "ws tls",
+			config:  map[string]any{"name": "vmess", "type": "vmess", "server": "1.1.1.1", "port": 443, "uuid": "b831381d-6324-4d53-ad4f-8cda48b30811", "cipher": "auto", "alterId": 0, "network": "ws", "tls": true},
+			network: "ws", tls: "on", want: "",
+		},
+		{
+			name:    "grpc",
+			config:  map[string]any{"name": "trojan", "type": "trojan", "server": "1.1.1.1", "port": 443, "password": "x", "network": "grpc"},
+			network: "ws", want: "不满足 -transport",
+		},
+		{
+			name:   "shadow-tls",
+			config: map[string]any{"name": "ss", "type": "ss", "server": "1.1.1.1", "port": 443, "cipher": "aes-128-gcm", "password": "x", "plugin": "shadow-tls", "plugin-opts": map[string]any{"host": "example.com", "password": "x", "version": 3}},
+			tls:    "on", want: "",
+		},
+		{
+			name:   "plain",
+			config: map[string]any{"name": "socks", "type": "socks5", "server": "1.1.1.1", "port": 1080},
+			tls:    "on", want: "不满足 -tls",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filter, err := ParseNodeFilter("", "", "", tt.network, tt.tls)
+			if err != nil {
+				t.Fatal(err)
+			}
+			proxy := testProxy(t, tt.config)
+			proxy.Config = providerConfig
+			if got := filter.Check(proxy); got != tt.want {
+				t.Errorf("Check() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,297 @@
+package speedtester
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/metacubex/mihomo/adapter"
+	"github.com/metacubex/mihomo/adapter/outboundgroup"
+	"github.com/metacubex/mihomo/common/utils"
+	"github.com/metacubex/mihomo/constant"
+	types "github.com/metacubex/mihomo/constant/provider"
+)
+
+// failoverTimeout 等待代理组切换到其他节点的最长时间，url-test 代理组会缓存选择结果 10 秒
+const failoverTimeout = 30 * time.Second
+
+// GroupResult 表示将代理组作为一个整体测试的结果
+type GroupResult struct {
+	Members  int             `json:"members"`  // 代理组中的节点数
+	Alive    int             `json:"alive"`    // 健康检查通过的节点数
+	Selected string          `json:"selected"` // 代理组实际选中的节点
+	Failover *FailoverResult `json:"failover,omitempty"`
+}
+
+// FailoverResult 表示选中的节点不可用时代理组切换到其他节点的情况
+type FailoverResult struct {
+	Down     string        `json:"down"`     // 模拟不可用的节点
+	Selected string        `json:"selected"` // 切换后选中的节点，为空表示超时仍未切换
+	Time     time.Duration `json:"time"`     // 从节点不可用到请求重新成功的时间
+}
+
+// Format 格式化为 选中 A (3/4 可用) 切换 2.3s → B 形式
+func (r *GroupResult) Format() string {
+	text := fmt.Sprintf("选中 %s (%d/%d 可用)", r.Selected, r.Alive, r.Members)
+	if r.Selected == "" {
+		text = fmt.Sprintf("无可用节点 (%d/%d 可用)", r.Alive, r.Members)
+	}
+	switch {
+	case r.Failover == nil:
+	case r.Failover.Selected == "":
+		text += " 切换超时"
+	default:
+		text += fmt.Sprintf(" 切换 %.1fs → %s", r.Failover.Time.Seconds(), r.Failover.Selected)
+	}
+	return text
+}
+
+// GroupColumn 显示代理组选中的节点和切换耗时
+var GroupColumn = Column{Name: "group", Header: "代理组", Value: func(r *Result) string {
+	if r.Group == nil {
+		return "N/A"
+	}
+	return r.Group.Format()
+}}
+
+// groupSource 解析代理组时使用的节点和 provider，用于重新创建代理组
+type groupSource struct {
+	config        map[string]any
+	proxyMap      map[string]constant.Proxy
+	providersMap  map[string]types.ProxyProvider
+	proxyNames    []string
+	providerNames []string
+}
+
+// isTestedGroup 返回节点是否为作为整体测试的自动选择代理组
+func isTestedGroup(proxyType constant.AdapterType) bool {
+	switch proxyType {
+	case constant.URLTest, constant.Fallback, constant.LoadBalance:
+		return true
+	}
+	return false
+}
+
+// groupReady 返回代理组引用的节点和代理组是否都已解析
+func groupReady(config map[string]any, proxyMap map[string]constant.Proxy) bool {
+	members, _ := config["proxies"].([]any)
+	for _, member := range members {
+		if name, ok := member.(string); ok && proxyMap[name] == nil {
+			return false
+		}
+	}
+	return true
+}
+
+// parseGroup 使用 mihomo 的代理组适配器解析代理组，解析会在 providersMap 中注册代理组，因此传入副本
+func (source *groupSource) parseGroup(proxyMap map[string]constant.Proxy) (constant.Proxy, error) {
+	providersMap := make(map[string]types.ProxyProvider, len(source.providersMap))
+	for name, pd := range source.providersMap {
+		providersMap[name] = pd
+	}
+	group, err := outboundgroup.ParseProxyGroup(source.config, proxyMap, providersMap, source.proxyNames, source.providerNames)
+	if err != nil {
+		return nil, err
+	}
+	return adapter.NewProxy(group), nil
+}
+
+// groupTestURL 返回代理组健康检查使用的地址
+func groupTestURL(config map[string]any) string {
+	if url, ok := config["url"].(string); ok && url != "" {
+		return url
+	}
+	return constant.DefaultTestURL
+}
+
+// groupMembers 返回代理组中的节点
+func groupMembers(proxy constant.Proxy) []constant.Proxy {
+	if group, ok := proxy.Adapter().(interface {
+		GetProxies(touch bool) []constant.Proxy
+	}); ok {
+		return group.GetProxies(false)
+	}
+	return nil
+}
+
+// testGroup 像客户端启动时一样先对代理组进行健康检查，再记录代理组实际选中的节点
+func (st *SpeedTester) testGroup(proxy *CProxy) *GroupResult {
+	group, ok := proxy.Adapter().(constant.Group)
+	if !ok {
+		return nil
+	}
+	result := &GroupResult{Members: len(groupMembers(proxy))}
+
+	ctx, cancel := context.WithTimeout(context.Background(), st.config.Timeout)
+	delays, err := group.URLTest(ctx, groupTestURL(proxy.Config), nil)
+	cancel()
+	if err != nil && st.debugMode {
+		fmt.Printf("代理组 %s 健康检查失败: %v\n", proxy.Name(), err)
+	}
+	result.Alive = len(delays)
+
+	ctx, cancel = context.WithTimeout(context.Background(), st.config.Timeout)
+	member, _, err := st.selectedMember(ctx, proxy)
+	cancel()
+	if err == nil {
+		result.Selected = member
+	} else if st.debugMode {
+		fmt.Printf("代理组 %s 请求失败: %v\n", proxy.Name(), err)
+	}
+	return result
+}
+
+// testFailover 将代理组选中的节点替换为无法连接的节点后重新创建代理组，
+// 测量代理组从连接失败、触发健康检查到请求重新成功的时间；轮询请求的流量计入流量预算，预算用完时停止测量
+func (st *SpeedTester) testFailover(proxy *CProxy, nodeResult *Result) {
+	result := nodeResult.Group
+	if _, ok := st.trafficLimit(nodeResult); !ok {
+		return
+	}
+	source := st.groupSources[proxy.Name()]
+	if source == nil || result.Selected == "" || result.Alive < 2 || source.proxyMap[result.Selected] == nil {
+		return
+	}
+
+	proxyMap := make(map[string]constant.Proxy, len(source.proxyMap))
+	for name, member := range source.proxyMap {
+		proxyMap[name] = member
+	}
+	proxyMap[result.Selected] = &downProxy{Proxy: source.proxyMap[result.Selected]}
+	group, err := source.parseGroup(proxyMap)
+	if err != nil {
+		if st.debugMode {
+			fmt.Printf("重新创建代理组 %s 失败: %v\n", proxy.Name(), err)
+		}
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), failoverTimeout)
+	defer cancel()
+
+	failover := &FailoverResult{Down: result.Selected}
+	start := time.Now()
+	for ctx.Err() == nil {
+		requestCtx, requestCancel := context.WithTimeout(ctx, st.config.Timeout)
+		member, traffic, err := st.selectedMember(requestCtx, group)
+		requestCancel()
+		nodeResult.TrafficBytes += traffic
+		st.traffic.used.Add(traffic)
+		if err == nil && member != result.Selected {
+			failover.Selected = member
+			failover.Time = time.Since(start)
+			break
+		}
+		if _, ok := st.trafficLimit(nodeResult); !ok {
+			if st.debugMode {
+				fmt.Printf("代理组 %s 切换测试流量预算用完\n", proxy.Name())
+			}
+			return
+		}
+		select {
+		case <-ctx.Done():
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+	result.Failover = failover
+}
+
+// selectedMember 通过代理组发送一次延迟请求，返回实际处理请求的组内节点和请求消耗的流量
+func (st *SpeedTester) selectedMember(ctx context.Context, group constant.Proxy) (string, int64, error) {
+	recorder := &chainRecorder{Proxy: group}
+	client := st.createSpeedClient(recorder)
+	client.Transport.(*http.Transport).DisableKeepAlives = true
+
+	req, err := st.config.Backend.LatencyRequest(ctx)
+	if err != nil {
+		return "", 0, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", recorder.traffic.Load(), err
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	if !isSuccessStatus(resp.StatusCode) {
+		return "", recorder.traffic.Load(), fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+
+	// Chains 从实际连接的节点开始，最后一项是代理组本身，倒数第二项是代理组直接选中的节点
+	chain, _ := recorder.chain.Load().(constant.Chain)
+	if len(chain) < 2 {
+		return "", recorder.traffic.Load(), fmt.Errorf("no member in chain")
+	}
+	return chain[len(chain)-2], recorder.traffic.Load(), nil
+}
+
+// chainRecorder 记录最近一次连接经过的代理链和所有连接传输的字节数
+type chainRecorder struct {
+	constant.Proxy
+	chain   atomic.Value
+	traffic atomic.Int64
+}
+
+func (p *chainRecorder) DialContext(ctx context.Context, metadata *constant.Metadata) (constant.Conn, error) {
+	conn, err := p.Proxy.DialContext(ctx, metadata)
+	if err != nil {
+		return nil, err
+	}
+	p.chain.Store(conn.Chains())
+	return &countingConn{Conn: conn, traffic: &p.traffic}, nil
+}
+
+// countingConn 统计连接读写的字节数
+type countingConn struct {
+	constant.Conn
+	traffic *atomic.Int64
+}
+
+func (c *countingConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	c.traffic.Add(int64(n))
+	return n, err
+}
+
+func (c *countingConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	c.traffic.Add(int64(n))
+	return n, err
+}
+
+// errDownProxy 包含 connection refused，代理组收到该错误时会立即进行健康检查
+var errDownProxy = errors.New("connect: connection refused")
+
+// downProxy 模拟不可用的节点：所有连接失败，被健康检查后标记为不可用，不影响原节点的状态
+type downProxy struct {
+	constant.Proxy
+	checked atomic.Bool
+}
+
+func (p *downProxy) DialContext(context.Context, *constant.Metadata) (constant.Conn, error) {
+	return nil, errDownProxy
+}
+
+func (p *downProxy) ListenPacketContext(context.Context, *constant.Metadata) (constant.PacketConn, error) {
+	return nil, errDownProxy
+}
+
+func (p *downProxy) URLTest(context.Context, string, utils.IntRanges[uint16]) (uint16, error) {
+	p.checked.Store(true)
+	return 0, errDownProxy
+}
+
+// AliveForTestUrl 健康检查之前沿用原节点的状态，与客户端中节点刚刚失效时一致
+func (p *downProxy) AliveForTestUrl(url string) bool {
+	return !p.checked.Load() && p.Proxy.AliveForTestUrl(url)
+}
+
+func (p *downProxy) LastDelayForTestUrl(url string) uint16 {
+	if p.checked.Load() {
+		return 0xffff
+	}
+	return p.Proxy.LastDelayForTestUrl(url)
+}
@@ -0,0 +1,91 @@
+package speedtester
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/netip"
+	"strings"
+
+	"github.com/metacubex/mihomo/constant"
+)
+
+// ipv6DomainURL 只有 AAAA 记录的地址，用于检测节点能否解析并访问 IPv6 域名
+const ipv6DomainURL = "https://ipv6.icanhazip.com"
+
+// IPStackResult 表示节点访问 IPv4 和 IPv6 目标的能力
+type IPStackResult struct {
+	IPv4       bool `json:"ipv4"`        // 能访问只有 IPv4 的地址
+	IPv6       bool `json:"ipv6"`        // 能访问只有 IPv6 的地址
+	IPv6Domain bool `json:"ipv6_domain"` // 能访问只有 AAAA 记录的域名
+}
+
+// DualStack 返回节点是否同时支持 IPv4 和 IPv6
+func (r *IPStackResult) DualStack() bool {
+	return r.IPv4 && r.IPv6
+}
+
+// Format 格式化为 双栈 / IPv4 / IPv6 / 不可用
+func (r *IPStackResult) Format() string {
+	switch {
+	case r.DualStack():
+		return "双栈"
+	case r.IPv4:
+		return "IPv4"
+	case r.IPv6:
+		return "IPv6"
+	default:
+		return "不可用"
+	}
+}
+
+// testIPStack 分别访问只有 IPv4 和只有 IPv6 的地址，并检测出口 IPv6 地址
+func (st *SpeedTester) testIPStack(proxy constant.Proxy, result *Result) {
+	// 启用出口 IP 检测时已经访问过 IPv4 和 IPv6 地址
+	if !st.config.DetectExitIP {
+		result.ExitIPv4, result.ExitIPv6 = st.testExitIP(proxy)
+	}
+	stack := &IPStackResult{
+		IPv4: result.ExitIPv4 != "",
+		IPv6: result.ExitIPv6 != "",
+	}
+
+	// IP 地址不需要解析，再访问只有 AAAA 记录的域名确认节点能解析 IPv6 域名
+	if ip := st.lookupIPv6Domain(proxy); ip != "" {
+		stack.IPv6Domain = true
+		stack.IPv6 = true
+		if result.ExitIPv6 == "" {
+			result.ExitIPv6 = ip
+		}
+	}
+	result.IPStack = stack
+}
+
+func (st *SpeedTester) lookupIPv6Domain(proxy constant.Proxy) string {
+	resp, err := st.createClient(proxy).Get(ipv6DomainURL)
+	if err != nil {
+		if st.debugMode {
+			fmt.Printf("访问 IPv6 域名失败: %v\n", err)
+		}
+		return ""
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	if err != nil || resp.StatusCode != http.StatusOK {
+		return ""
+	}
+	ip, err := netip.ParseAddr(strings.TrimSpace(string(body)))
+	if err != nil || !ip.Is6() {
+		return ""
+	}
+	return ip.String()
+}
+
+// IPStackColumn 显示节点的 IPv4/IPv6 支持情况
+var IPStackColumn = Column{Name: "ipstack", Header: "IP栈", Value: func(r *Result) string {
+	if r.IPStack == nil {
+		return "N/A"
+	}
+	return r.IPStack.Format()
+}}
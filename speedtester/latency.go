@@ -0,0 +1,218 @@
+package speedtester
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"math"
+	"net"
+	"net/http/httptrace"
+	"net/netip"
+	"strings"
+	"time"
+
+	"github.com/metacubex/mihomo/component/dialer"
+	"github.com/metacubex/mihomo/constant"
+)
+
+// 延迟细分列名称
+const (
+	LatencyColumnDial   = "dial"
+	LatencyColumnTLS    = "tls"
+	LatencyColumnTTFB   = "ttfb"
+	LatencyColumnTCP    = "tcp"
+	LatencyColumnCold   = "cold"
+	LatencyColumnMin    = "min"
+	LatencyColumnMedian = "median"
+	LatencyColumnP90    = "p90"
+	LatencyColumnP99    = "p99"
+	LatencyColumnMax    = "max"
+)
+
+// Column 表示结果表格中的一个可选列
+type Column struct {
+	Name   string
+	Header string
+	Value  func(r *Result) string
+}
+
+var latencyColumns = []Column{
+	{Name: LatencyColumnDial, Header: "代理握手", Value: func(r *Result) string { return formatLatency(r.DialLatency) }},
+	{Name: LatencyColumnTLS, Header: "TLS握手", Value: func(r *Result) string { return formatLatency(r.TLSLatency) }},
+	{Name: LatencyColumnTTFB, Header: "首字节", Value: func(r *Result) string { return formatLatency(r.TTFB) }},
+	{Name: LatencyColumnTCP, Header: "TCP延迟", Value: func(r *Result) string { return formatLatency(r.TCPLatency) }},
+	{Name: LatencyColumnCold, Header: "首次延迟", Value: func(r *Result) string { return formatLatency(r.ColdLatency) }},
+	{Name: LatencyColumnMin, Header: "最小", Value: func(r *Result) string { return formatLatency(r.LatencyMin) }},
+	{Name: LatencyColumnMedian, Header: "中位数", Value: func(r *Result) string { return formatLatency(r.LatencyMedian) }},
+	{Name: LatencyColumnP90, Header: "P90", Value: func(r *Result) string { return formatLatency(r.LatencyP90) }},
+	{Name: LatencyColumnP99, Header: "P99", Value: func(r *Result) string { return formatLatency(r.LatencyP99) }},
+	{Name: LatencyColumnMax, Header: "最大", Value: func(r *Result) string { return formatLatency(r.LatencyMax) }},
+}
+
+// ParseLatencyColumns 解析逗号分隔的延迟细分列名称，可选 dial,tls,ttfb,tcp,cold,min,median,p90,p99,max
+func ParseLatencyColumns(names string) ([]Column, error) {
+	var columns []Column
+	for _, name := range strings.Split(names, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		found := false
+		for _, column := range latencyColumns {
+			if column.Name == name {
+				columns = append(columns, column)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown latency column: %s", name)
+		}
+	}
+	return columns, nil
+}
+
+// UDPColumn 显示 UDP 探测结果的列
+var UDPColumn = Column{Name: "udp", Header: "UDP", Value: func(r *Result) string {
+	if r.UDP == nil {
+		return "N/A"
+	}
+	return r.UDP.Format()
+}}
+
+func formatLatency(d time.Duration) string {
+	if d == 0 {
+		return "N/A"
+	}
+	return fmt.Sprintf("%dms", d.Milliseconds())
+}
+
+// pingTrace 记录单次延迟请求各阶段的耗时，复用连接时握手阶段为 0
+type pingTrace struct {
+	getConn      time.Time
+	tlsStart     time.Time
+	wroteRequest time.Time
+	dial         time.Duration // 通过代理建立到测速服务器的连接(包含代理协议握手)
+	tls          time.Duration // 与测速服务器的 TLS 握手
+	ttfb         time.Duration // 请求发出到收到首字节
+}
+
+// withPingTrace 返回带 httptrace 的 context，请求结束后 trace 中保存各阶段耗时
+func withPingTrace(ctx context.Context) (context.Context, *pingTrace) {
+	trace := &pingTrace{}
+	return httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		// 自定义 DialContext 不会触发 ConnectStart/ConnectDone，也不会在本地解析 DNS，
+		// 因此按 GetConn 到 TLS 开始(或拿到连接)的时间计算代理握手耗时
+		GetConn: func(string) {
+			trace.getConn = time.Now()
+		},
+		TLSHandshakeStart: func() {
+			trace.tlsStart = time.Now()
+			trace.dial = trace.tlsStart.Sub(trace.getConn)
+		},
+		TLSHandshakeDone: func(tls.ConnectionState, error) {
+			trace.tls = time.Since(trace.tlsStart)
+		},
+		GotConn: func(info httptrace.GotConnInfo) {
+			if !info.Reused && trace.tlsStart.IsZero() {
+				trace.dial = time.Since(trace.getConn)
+			}
+		},
+		WroteRequest: func(httptrace.WroteRequestInfo) {
+			trace.wroteRequest = time.Now()
+		},
+		GotFirstResponseByte: func() {
+			trace.ttfb = time.Since(trace.wroteRequest)
+		},
+	}), trace
+}
+
+// latencyBreakdown 累计多次请求的各阶段耗时，只统计实际发生的阶段
+type latencyBreakdown struct {
+	dial, tls, ttfb    time.Duration
+	dialN, tlsN, ttfbN int
+}
+
+func (b *latencyBreakdown) add(trace *pingTrace) {
+	if trace.dial > 0 {
+		b.dial += trace.dial
+		b.dialN++
+	}
+	if trace.tls > 0 {
+		b.tls += trace.tls
+		b.tlsN++
+	}
+	if trace.ttfb > 0 {
+		b.ttfb += trace.ttfb
+		b.ttfbN++
+	}
+}
+
+// percentile 使用最近秩法计算已排序样本的分位数
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+// interarrivalJitter 按 RFC 3550 计算抖动：J += (|D(i-1,i)| - J) / 16，
+// D 为相邻两次请求的延迟差
+func interarrivalJitter(latencies []time.Duration) time.Duration {
+	var jitter float64
+	for i := 1; i < len(latencies); i++ {
+		d := math.Abs(float64(latencies[i] - latencies[i-1]))
+		jitter += (d - jitter) / 16
+	}
+	return time.Duration(jitter)
+}
+
+func averageDuration(total time.Duration, n int) time.Duration {
+	if n == 0 {
+		return 0
+	}
+	return total / time.Duration(n)
+}
+
+// testTCPLatency 与代理服务器建立 TCP 连接测量延迟，不经过代理协议；设置了 -via 时经过前置代理连接，与节点实际的连接路径一致
+func (st *SpeedTester) testTCPLatency(proxy constant.Proxy) time.Duration {
+	addr := proxy.Addr()
+	if addr == "" {
+		return 0
+	}
+
+	var total time.Duration
+	var count int
+	for i := 0; i < 3; i++ {
+		ctx, cancel := context.WithTimeout(context.Background(), st.config.Timeout)
+		start := time.Now()
+		conn, err := st.dialTCP(ctx, addr)
+		cancel()
+		if err != nil {
+			if st.debugMode {
+				fmt.Printf("TCP 连接 %s 失败: %v\n", addr, err)
+			}
+			continue
+		}
+		total += time.Since(start)
+		count++
+		conn.Close()
+	}
+	return averageDuration(total, count)
+}
+
+// dialTCP 建立测量 TCP 延迟使用的连接，设置了前置代理时由前置代理连接 addr
+func (st *SpeedTester) dialTCP(ctx context.Context, addr string) (net.Conn, error) {
+	if st.viaProxy == nil {
+		return dialer.DialContext(ctx, "tcp", addr, st.dialOptions()...)
+	}
+	host, port := splitAddr(addr)
+	metadata := &constant.Metadata{DstPort: port}
+	if ip, err := netip.ParseAddr(host); err == nil {
+		metadata.DstIP = ip
+	} else {
+		metadata.Host = host
+	}
+	return st.viaProxy.DialContext(ctx, metadata)
+}
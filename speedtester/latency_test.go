@@ -0,0 +1,87 @@
+package speedtester
+
+import (
+	"testing"
+	"time"
+)
+
+func ms(values ...float64) []time.Duration {
+	durations := make([]time.Duration, len(values))
+	for i, v := range values {
+		durations[i] = time.Duration(v * float64(time.Millisecond))
+	}
+	return durations
+}
+
+// 最近秩法：rank = ceil(p/100 * n)，取第 rank 个值
+func TestPercentile(t *testing.T) {
+	tests := []struct {
+		sorted []time.Duration
+		p      float64
+		want   time.Duration
+	}{
+		{sorted: ms(15, 20, 35, 40, 50), p: 5, want: 15 * time.Millisecond},
+		{sorted: ms(15, 20, 35, 40, 50), p: 30, want: 20 * time.Millisecond},
+		{sorted: ms(15, 20, 35, 40, 50), p: 40, want: 20 * time.Millisecond},
+		{sorted: ms(15, 20, 35, 40, 50), p: 50, want: 35 * time.Millisecond},
+		{sorted: ms(15, 20, 35, 40, 50), p: 100, want: 50 * time.Millisecond},
+		{sorted: ms(1, 2, 3, 4, 5, 6, 7, 8, 9, 10), p: 50, want: 5 * time.Millisecond},
+		{sorted: ms(1, 2, 3, 4, 5, 6, 7, 8, 9, 10), p: 90, want: 9 * time.Millisecond},
+		{sorted: ms(1, 2, 3, 4, 5, 6, 7, 8, 9, 10), p: 99, want: 10 * time.Millisecond},
+		{sorted: ms(1, 2, 3, 4, 5, 6, 7, 8, 9, 10), p: 0, want: 1 * time.Millisecond},
+		{sorted: ms(42), p: 99, want: 42 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		if got := percentile(tt.sorted, tt.p); got != tt.want {
+			t.Errorf("percentile(%v, %v) = %v, want %v", tt.sorted, tt.p, got, tt.want)
+		}
+	}
+}
+
+// RFC 3550：J += (|D(i-1,i)| - J) / 16
+func TestInterarrivalJitter(t *testing.T) {
+	tests := []struct {
+		latencies []time.Duration
+		want      time.Duration
+	}{
+		{latencies: nil, want: 0},
+		{latencies: ms(100), want: 0},
+		{latencies: ms(100, 100, 100), want: 0},
+		{latencies: ms(100, 116), want: time.Millisecond},
+		{latencies: ms(116, 100), want: time.Millisecond},
+		{latencies: ms(100, 116, 100), want: 1937500 * time.Nanosecond},
+		{latencies: ms(100, 132, 100, 132), want: 5632812 * time.Nanosecond},
+	}
+	for _, tt := range tests {
+		if got := interarrivalJitter(tt.latencies); got != tt.want {
+			t.Errorf("interarrivalJitter(%v) = %v, want %v", tt.latencies, got, tt.want)
+		}
+	}
+}
+
+func TestCalculateLatencyStats(t *testing.T) {
+	result := calculateLatencyStats(300*time.Millisecond, ms(40, 10, 30, 20), 1, 6)
+	if result.cold != 300*time.Millisecond || result.avgLatency != 25*time.Millisecond {
+		t.Errorf("cold %v avg %v, want 300ms 25ms", result.cold, result.avgLatency)
+	}
+	if result.min != 10*time.Millisecond || result.median != 20*time.Millisecond ||
+		result.p90 != 40*time.Millisecond || result.max != 40*time.Millisecond {
+		t.Errorf("min %v median %v p90 %v max %v", result.min, result.median, result.p90, result.max)
+	}
+	// 抖动按请求顺序而不是排序后的顺序计算
+	if want := interarrivalJitter(ms(40, 10, 30, 20)); result.jitter != want {
+		t.Errorf("jitter %v, want %v", result.jitter, want)
+	}
+	if result.packetLoss < 16.66 || result.packetLoss > 16.67 {
+		t.Errorf("packet loss %v, want 16.67", result.packetLoss)
+	}
+
+	// 只有第一次请求成功时使用它作为唯一样本
+	coldOnly := calculateLatencyStats(300*time.Millisecond, nil, 5, 6)
+	if coldOnly.avgLatency != 300*time.Millisecond || coldOnly.median != 300*time.Millisecond {
+		t.Errorf("cold only avg %v median %v, want 300ms", coldOnly.avgLatency, coldOnly.median)
+	}
+	if failed := calculateLatencyStats(0, nil, 6, 6); failed.avgLatency != 0 || failed.packetLoss != 100 {
+		t.Errorf("all failed avg %v loss %v", failed.avgLatency, failed.packetLoss)
+	}
+}
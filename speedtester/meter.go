@@ -0,0 +1,313 @@
+package speedtester
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/metacubex/mihomo/constant"
+)
+
+const (
+	// sampleInterval 按时长测速时的采样间隔
+	sampleInterval = time.Second
+	// durationRequestSize 按时长测速时单次请求的数据量(测速服务器通常限制在 100MB 以内)，请求提前结束会重新发起
+	durationRequestSize = 100 * 1000 * 1000
+)
+
+// throughputSample 表示一个采样区间内传输的字节数
+type throughputSample struct {
+	offset   time.Duration // 区间起点距离开始的时间
+	duration time.Duration
+	bytes    int64
+}
+
+// throughputMeter 统计多个连接共享的传输字节数，并按固定间隔采样
+type throughputMeter struct {
+	bytes    atomic.Int64
+	start    time.Time
+	end      time.Time
+	interval time.Duration
+	samples  []throughputSample
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+func newThroughputMeter(interval time.Duration) *throughputMeter {
+	return &throughputMeter{
+		interval: interval,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+}
+
+// Start 开始计时并在后台采样
+func (m *throughputMeter) Start() {
+	m.start = time.Now()
+	go func() {
+		defer close(m.done)
+		ticker := time.NewTicker(m.interval)
+		defer ticker.Stop()
+
+		last := m.start
+		var lastBytes int64
+		record := func(now time.Time) {
+			total := m.bytes.Load()
+			m.samples = append(m.samples, throughputSample{
+				offset:   last.Sub(m.start),
+				duration: now.Sub(last),
+				bytes:    total - lastBytes,
+			})
+			last, lastBytes = now, total
+		}
+
+		for {
+			select {
+			case now := <-ticker.C:
+				record(now)
+			case <-m.stop:
+				m.end = time.Now()
+				if m.end.After(last) {
+					record(m.end)
+				}
+				return
+			}
+		}
+	}()
+}
+
+// Stop 停止采样，记录最后一个不完整的区间
+func (m *throughputMeter) Stop() {
+	close(m.stop)
+	<-m.done
+}
+
+func (m *throughputMeter) Add(n int64) {
+	m.bytes.Add(n)
+}
+
+func (m *throughputMeter) Bytes() int64 {
+	return m.bytes.Load()
+}
+
+func (m *throughputMeter) Elapsed() time.Duration {
+	return m.end.Sub(m.start)
+}
+
+// Speeds 返回每个采样区间的速度(字节/秒)
+func (m *throughputMeter) Speeds() []float64 {
+	speeds := make([]float64, 0, len(m.samples))
+	for _, sample := range m.samples {
+		if sample.duration <= 0 {
+			continue
+		}
+		speeds = append(speeds, float64(sample.bytes)/sample.duration.Seconds())
+	}
+	return speeds
+}
+
+// Peak 返回完整采样区间中的最高速度
+func (m *throughputMeter) Peak() float64 {
+	var peak float64
+	for _, sample := range m.samples {
+		// 最后一个不完整的区间时间太短，容易放大误差
+		if sample.duration < m.interval/2 {
+			continue
+		}
+		if speed := float64(sample.bytes) / sample.duration.Seconds(); speed > peak {
+			peak = speed
+		}
+	}
+	return peak
+}
+
+// SteadySpeed 返回丢弃预热区间后的平均速度，预热覆盖全部区间时使用全部数据
+func (m *throughputMeter) SteadySpeed(warmup time.Duration) float64 {
+	var bytes int64
+	var duration time.Duration
+	for _, sample := range m.samples {
+		if sample.offset < warmup {
+			continue
+		}
+		bytes += sample.bytes
+		duration += sample.duration
+	}
+	if duration <= 0 {
+		bytes, duration = m.Bytes(), m.Elapsed()
+	}
+	if duration <= 0 {
+		return 0
+	}
+	return float64(bytes) / duration.Seconds()
+}
+
+// meterReader 将读取的字节数计入 streamCounter
+type meterReader struct {
+	reader  io.Reader
+	counter *streamCounter
+}
+
+func (r *meterReader) Read(p []byte) (int, error) {
+	// 达到流量上限后立即停止读取，避免其他连接在取消生效前继续消耗流量
+	if r.counter.exhausted() {
+		return 0, errTrafficLimit
+	}
+	n, err := r.reader.Read(p)
+	r.counter.Add(int64(n))
+	return n, err
+}
+
+// streamFunc 表示单个连接上的一次下载或上传请求
+type streamFunc func(ctx context.Context, client *http.Client, size int, counter *streamCounter) error
+
+// speedRun 汇总一个方向上所有并发连接的测速结果
+type speedRun struct {
+	meter       *throughputMeter
+	failed      int   // 出错的连接数
+	failedBytes int64 // 出错的请求在出错前传输的字节数，不含同一连接之前成功的请求
+	mismatched  int   // 服务端统计的字节数与客户端不一致的请求数
+	capped      bool  // 达到流量上限被提前结束
+}
+
+// testSpeedFixed 每个连接传输固定数据量，速度按所有连接的总字节数除以从开始到最后一个连接结束的时间计算
+func (st *SpeedTester) testSpeedFixed(proxy constant.Proxy, result *Result) {
+	limit, ok := st.trafficLimit(result)
+	if !ok {
+		result.TrafficSkipped = true
+		return
+	}
+	// 按下载和上传的数据量比例分配流量，保证上传阶段也有流量可用
+	downloadLimit := splitTrafficLimit(limit, float64(st.config.DownloadSize)/float64(st.config.DownloadSize+st.config.UploadSize))
+	download := st.runStreams(proxy, st.config.DownloadSize/st.config.Concurrent, 0, downloadLimit, st.testDownload)
+	st.addTraffic(result, download)
+	result.DownloadSize = float64(download.meter.Bytes())
+	result.DownloadTime = download.meter.Elapsed()
+	result.DownloadFailedStreams = download.failed
+	result.DownloadFailedBytes = download.failedBytes
+	result.DownloadMismatches = download.mismatched
+	if download.failed < st.config.Concurrent {
+		result.DownloadSpeed = download.meter.SteadySpeed(0)
+	}
+
+	if !st.config.Backend.SupportsUpload() {
+		return
+	}
+	if limit, ok = st.trafficLimit(result); !ok {
+		return
+	}
+	upload := st.runStreams(proxy, st.config.UploadSize/st.config.Concurrent, 0, limit, st.testUpload)
+	st.addTraffic(result, upload)
+	result.UploadSize = float64(upload.meter.Bytes())
+	result.UploadTime = upload.meter.Elapsed()
+	result.UploadFailedStreams = upload.failed
+	result.UploadFailedBytes = upload.failedBytes
+	result.UploadMismatches = upload.mismatched
+	if upload.failed < st.config.Concurrent {
+		result.UploadSpeed = upload.meter.SteadySpeed(0)
+	}
+}
+
+// testSpeedDuration 在固定时长内测量下载和上传速度，所有并发连接共享同一个计量器
+func (st *SpeedTester) testSpeedDuration(proxy constant.Proxy, result *Result) {
+	limit, ok := st.trafficLimit(result)
+	if !ok {
+		result.TrafficSkipped = true
+		return
+	}
+	download := st.runStreams(proxy, durationRequestSize, st.config.TestDuration, splitTrafficLimit(limit, 0.5), st.testDownload)
+	st.addTraffic(result, download)
+	result.DownloadSize = float64(download.meter.Bytes())
+	result.DownloadTime = download.meter.Elapsed()
+	result.DownloadSpeed = download.meter.SteadySpeed(st.config.Warmup)
+	result.DownloadPeak = download.meter.Peak()
+	result.DownloadSamples = download.meter.Speeds()
+	result.DownloadFailedStreams = download.failed
+	result.DownloadFailedBytes = download.failedBytes
+	result.DownloadMismatches = download.mismatched
+
+	if !st.config.Backend.SupportsUpload() {
+		return
+	}
+	if limit, ok = st.trafficLimit(result); !ok {
+		return
+	}
+	upload := st.runStreams(proxy, durationRequestSize, st.config.TestDuration, limit, st.testUpload)
+	st.addTraffic(result, upload)
+	result.UploadSize = float64(upload.meter.Bytes())
+	result.UploadTime = upload.meter.Elapsed()
+	result.UploadSpeed = upload.meter.SteadySpeed(st.config.Warmup)
+	result.UploadPeak = upload.meter.Peak()
+	result.UploadSamples = upload.meter.Speeds()
+	result.UploadFailedStreams = upload.failed
+	result.UploadFailedBytes = upload.failedBytes
+	result.UploadMismatches = upload.mismatched
+}
+
+// runStreams 并发执行 stream，duration 为 0 时每个连接只请求一次，否则持续请求直到时长结束，
+// limit 大于 0 时所有连接的总字节数达到 limit 后提前结束
+func (st *SpeedTester) runStreams(proxy constant.Proxy, size int, duration time.Duration, limit int64, stream streamFunc) *speedRun {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if duration > 0 {
+		var timeoutCancel context.CancelFunc
+		ctx, timeoutCancel = context.WithTimeout(ctx, duration)
+		defer timeoutCancel()
+	}
+
+	run := &speedRun{meter: newThroughputMeter(sampleInterval)}
+	run.meter.Start()
+
+	var wg sync.WaitGroup
+	var mutex sync.Mutex
+	for i := 0; i < st.config.Concurrent; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			client := st.createSpeedClient(proxy)
+			if duration > 0 {
+				client.Timeout = 0
+			}
+			counter := &streamCounter{meter: run.meter, limit: limit, stop: cancel}
+			for {
+				// counter 在同一连接的多次请求之间累计，出错时只统计本次请求传输的字节数
+				start := counter.bytes
+				err := stream(ctx, client, size, counter)
+				// 请求已经完成但字节数与服务端统计不一致，记录后继续
+				var mismatch *byteMismatchError
+				if errors.As(err, &mismatch) {
+					if st.debugMode {
+						fmt.Printf("测速字节数与服务端不一致: %v\n", err)
+					}
+					mutex.Lock()
+					run.mismatched++
+					mutex.Unlock()
+					err = nil
+				}
+				if err != nil && ctx.Err() == nil {
+					transferred := counter.bytes - start
+					if st.debugMode {
+						fmt.Printf("测速连接出错(已传输 %d 字节): %v\n", transferred, err)
+					}
+					mutex.Lock()
+					run.failed++
+					run.failedBytes += transferred
+					mutex.Unlock()
+					return
+				}
+				// 单次请求提前结束时继续发起新请求，直到时长用完
+				if duration == 0 || ctx.Err() != nil {
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	run.meter.Stop()
+	run.capped = limit > 0 && run.meter.Bytes() >= limit
+	return run
+}
@@ -0,0 +1,127 @@
+package speedtester
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"math"
+	"testing"
+	"time"
+)
+
+// syntheticMeter 使用固定的采样数据构造计量器，每个区间 1 秒
+func syntheticMeter(sampleBytes ...int64) *throughputMeter {
+	m := newThroughputMeter(time.Second)
+	m.start = time.Unix(0, 0)
+	var total int64
+	for i, n := range sampleBytes {
+		m.samples = append(m.samples, throughputSample{offset: time.Duration(i) * time.Second, duration: time.Second, bytes: n})
+		total += n
+	}
+	m.end = m.start.Add(time.Duration(len(sampleBytes)) * time.Second)
+	m.bytes.Store(total)
+	return m
+}
+
+func TestSteadySpeed(t *testing.T) {
+	tests := []struct {
+		name    string
+		samples []int64
+		warmup  time.Duration
+		want    float64
+	}{
+		{name: "no warmup", samples: []int64{100, 200, 300}, warmup: 0, want: 200},
+		{name: "discard first", samples: []int64{100, 200, 300}, warmup: time.Second, want: 250},
+		// 区间起点早于预热结束的都丢弃
+		{name: "partial interval", samples: []int64{100, 200, 300}, warmup: 1500 * time.Millisecond, want: 300},
+		{name: "warmup covers all", samples: []int64{100, 200, 300}, warmup: 10 * time.Second, want: 200},
+		{name: "empty", samples: nil, warmup: 0, want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := syntheticMeter(tt.samples...).SteadySpeed(tt.warmup); math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("SteadySpeed() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPeakAndSpeeds(t *testing.T) {
+	m := syntheticMeter(100, 400, 200)
+	// 最后一个不完整的区间速度很高，但时间太短，不计入峰值
+	m.samples = append(m.samples,
+		throughputSample{offset: 3 * time.Second, duration: 100 * time.Millisecond, bytes: 1000},
+		throughputSample{offset: 3100 * time.Millisecond, duration: 0, bytes: 0},
+	)
+	if got := m.Peak(); got != 400 {
+		t.Errorf("Peak() = %v, want 400", got)
+	}
+
+	want := []float64{100, 400, 200, 10000}
+	got := m.Speeds()
+	if len(got) != len(want) {
+		t.Fatalf("Speeds() = %v, want %v", got, want)
+	}
+	for i := range want {
+		if math.Abs(got[i]-want[i]) > 1e-6 {
+			t.Errorf("Speeds()[%d] = %v, want %v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestThroughputMeterSampling(t *testing.T) {
+	m := newThroughputMeter(10 * time.Millisecond)
+	m.Start()
+	for i := 0; i < 5; i++ {
+		m.Add(1000)
+		time.Sleep(7 * time.Millisecond)
+	}
+	m.Stop()
+
+	if len(m.samples) == 0 {
+		t.Fatal("no samples recorded")
+	}
+	var total int64
+	var next time.Duration
+	for i, sample := range m.samples {
+		if sample.offset != next {
+			t.Errorf("sample %d offset = %v, want %v", i, sample.offset, next)
+		}
+		next = sample.offset + sample.duration
+		total += sample.bytes
+	}
+	if total != m.Bytes() || total != 5000 {
+		t.Errorf("samples total %d bytes, meter %d, want 5000", total, m.Bytes())
+	}
+	if next != m.Elapsed() {
+		t.Errorf("samples cover %v, elapsed %v", next, m.Elapsed())
+	}
+}
+
+func TestMeterReaderLimit(t *testing.T) {
+	m := newThroughputMeter(time.Second)
+	stopped := false
+	counter := &streamCounter{meter: m, limit: 10, stop: func() { stopped = true }}
+	reader := &meterReader{reader: bytes.NewReader(make([]byte, 100)), counter: counter}
+
+	buf := make([]byte, 8)
+	var read int
+	var err error
+	for err == nil {
+		var n int
+		n, err = reader.Read(buf)
+		read += n
+	}
+	if !errors.Is(err, errTrafficLimit) {
+		t.Errorf("err = %v, want errTrafficLimit", err)
+	}
+	if read != 16 || counter.bytes != 16 || !stopped {
+		t.Errorf("read %d bytes, counter %d, stopped %v; want 16, 16, true", read, counter.bytes, stopped)
+	}
+
+	unlimited := &streamCounter{meter: newThroughputMeter(time.Second), stop: func() {}}
+	n, err := io.Copy(io.Discard, &meterReader{reader: bytes.NewReader(make([]byte, 100)), counter: unlimited})
+	if err != nil || n != 100 || unlimited.bytes != 100 {
+		t.Errorf("unlimited copy = %d, %v, counter %d", n, err, unlimited.bytes)
+	}
+}
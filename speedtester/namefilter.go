@@ -0,0 +1,285 @@
+package speedtester
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// NameFilter 按节点名称筛选：名称需要匹配任一包含规则(未设置时全部包含)、不匹配任何排除规则，并满足筛选表达式
+type NameFilter struct {
+	includes   []*regexp.Regexp
+	excludes   []*regexp.Regexp
+	patterns   []string // 排除规则的原始表达式，用于输出匹配的规则
+	expr       filterExpr
+	expression string
+}
+
+// ParseNameFilter 解析节点名称筛选规则，所有规则都为空时返回 nil
+//   - includes: 包含规则的正则表达式列表
+//   - excludes: 排除规则列表，与原来的关键词屏蔽一致，按 | 分隔的关键词匹配且始终忽略大小写；
+//     写成 /正则/ 时按正则表达式匹配
+//   - expression: 筛选表达式，由 /正则/ 或不含空格和运算符的正则、&&、||、! 和括号组成，
+//     如 (/HK|SG/ || 日本) && !/IPLC/i，/正则/i 单独忽略大小写
+//   - ignoreCase: 包含规则和筛选表达式也忽略大小写
+func ParseNameFilter(includes, excludes []string, expression string, ignoreCase bool) (*NameFilter, error) {
+	filter := &NameFilter{expression: strings.TrimSpace(expression)}
+	for _, pattern := range includes {
+		re, err := compileNamePattern(pattern, ignoreCase)
+		if err != nil {
+			return nil, fmt.Errorf("invalid include pattern %q: %w", pattern, err)
+		}
+		filter.includes = append(filter.includes, re)
+	}
+	for _, pattern := range excludes {
+		re, err := compileExcludePattern(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid exclude pattern %q: %w", pattern, err)
+		}
+		if re == nil {
+			continue
+		}
+		filter.excludes = append(filter.excludes, re)
+		filter.patterns = append(filter.patterns, pattern)
+	}
+	if filter.expression != "" {
+		parser := &exprParser{input: filter.expression, ignoreCase: ignoreCase}
+		expr, err := parser.parse()
+		if err != nil {
+			return nil, fmt.Errorf("invalid filter expression: %w", err)
+		}
+		filter.expr = expr
+	}
+
+	if len(filter.includes) == 0 && len(filter.excludes) == 0 && filter.expr == nil {
+		return nil, nil
+	}
+	return filter, nil
+}
+
+// Check 返回节点被筛掉的原因，节点保留时返回空字符串
+func (f *NameFilter) Check(name string) string {
+	if f == nil {
+		return ""
+	}
+	for i, re := range f.excludes {
+		if re.MatchString(name) {
+			return fmt.Sprintf("匹配排除规则 -b '%s'", f.patterns[i])
+		}
+	}
+	if len(f.includes) > 0 {
+		included := false
+		for _, re := range f.includes {
+			if re.MatchString(name) {
+				included = true
+				break
+			}
+		}
+		if !included {
+			return "不匹配任何包含规则 -f"
+		}
+	}
+	if f.expr != nil && !f.expr.eval(name) {
+		return fmt.Sprintf("不满足表达式 -filter '%s'", f.expression)
+	}
+	return ""
+}
+
+func compileNamePattern(pattern string, ignoreCase bool) (*regexp.Regexp, error) {
+	if ignoreCase {
+		pattern = "(?i)" + pattern
+	}
+	return regexp.Compile(pattern)
+}
+
+// compileExcludePattern 编译排除规则：/正则/ 或 /正则/i 按正则表达式匹配，其他按 | 分隔为关键词，
+// 关键词中的 . + ( [ 等字符按字面匹配；没有任何关键词时返回 nil
+func compileExcludePattern(pattern string) (*regexp.Regexp, error) {
+	body := strings.TrimSuffix(pattern, "i")
+	if len(body) >= 2 && strings.HasPrefix(body, "/") && strings.HasSuffix(body, "/") {
+		return compileNamePattern(strings.ReplaceAll(body[1:len(body)-1], `\/`, "/"), true)
+	}
+
+	var keywords []string
+	for _, keyword := range strings.Split(pattern, "|") {
+		if keyword = strings.TrimSpace(keyword); keyword != "" {
+			keywords = append(keywords, regexp.QuoteMeta(keyword))
+		}
+	}
+	if len(keywords) == 0 {
+		return nil, nil
+	}
+	return compileNamePattern(strings.Join(keywords, "|"), true)
+}
+
+// filterExpr 筛选表达式的语法树节点
+type filterExpr interface {
+	eval(name string) bool
+}
+
+type regexTerm struct {
+	re *regexp.Regexp
+}
+
+func (t *regexTerm) eval(name string) bool {
+	return t.re.MatchString(name)
+}
+
+type notExpr struct {
+	x filterExpr
+}
+
+func (e *notExpr) eval(name string) bool {
+	return !e.x.eval(name)
+}
+
+type binaryExpr struct {
+	and         bool
+	left, right filterExpr
+}
+
+func (e *binaryExpr) eval(name string) bool {
+	if e.and {
+		return e.left.eval(name) && e.right.eval(name)
+	}
+	return e.left.eval(name) || e.right.eval(name)
+}
+
+// exprParser 递归下降解析筛选表达式，优先级从低到高为 ||、&&、!
+type exprParser struct {
+	input      string
+	pos        int
+	ignoreCase bool
+}
+
+func (p *exprParser) parse() (filterExpr, error) {
+	expr, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.skipSpace(); p.pos < len(p.input) {
+		return nil, p.errorf("unexpected %q", p.input[p.pos])
+	}
+	return expr, nil
+}
+
+func (p *exprParser) parseOr() (filterExpr, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.consume("||") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryExpr{left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *exprParser) parseAnd() (filterExpr, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.consume("&&") {
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = &binaryExpr{and: true, left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *exprParser) parseUnary() (filterExpr, error) {
+	if p.consume("!") {
+		x, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &notExpr{x: x}, nil
+	}
+	if p.consume("(") {
+		x, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if !p.consume(")") {
+			return nil, p.errorf("missing )")
+		}
+		return x, nil
+	}
+	return p.parseTerm()
+}
+
+// parseTerm 解析 /正则/ 或不含空格和运算符的正则，/正则/ 中的 / 需要写成 \/
+func (p *exprParser) parseTerm() (filterExpr, error) {
+	p.skipSpace()
+	if p.pos >= len(p.input) {
+		return nil, p.errorf("missing pattern")
+	}
+
+	start := p.pos
+	var pattern string
+	ignoreCase := p.ignoreCase
+	if p.input[p.pos] == '/' {
+		var b strings.Builder
+		p.pos++
+		for {
+			if p.pos >= len(p.input) {
+				return nil, fmt.Errorf("unterminated pattern at position %d", start+1)
+			}
+			c := p.input[p.pos]
+			if c == '/' {
+				p.pos++
+				break
+			}
+			if c == '\\' && p.pos+1 < len(p.input) && p.input[p.pos+1] == '/' {
+				c = '/'
+				p.pos++
+			}
+			b.WriteByte(c)
+			p.pos++
+		}
+		if p.pos < len(p.input) && p.input[p.pos] == 'i' {
+			ignoreCase = true
+			p.pos++
+		}
+		pattern = b.String()
+	} else {
+		for p.pos < len(p.input) && !strings.ContainsRune(" \t&|!()", rune(p.input[p.pos])) {
+			p.pos++
+		}
+		pattern = p.input[start:p.pos]
+		if pattern == "" {
+			return nil, p.errorf("unexpected %q", p.input[p.pos])
+		}
+	}
+
+	re, err := compileNamePattern(pattern, ignoreCase)
+	if err != nil {
+		return nil, fmt.Errorf("pattern %q at position %d: %w", pattern, start+1, err)
+	}
+	return &regexTerm{re: re}, nil
+}
+
+func (p *exprParser) consume(token string) bool {
+	p.skipSpace()
+	if strings.HasPrefix(p.input[p.pos:], token) {
+		p.pos += len(token)
+		return true
+	}
+	return false
+}
+
+func (p *exprParser) skipSpace() {
+	for p.pos < len(p.input) && (p.input[p.pos] == ' ' || p.input[p.pos] == '\t') {
+		p.pos++
+	}
+}
+
+func (p *exprParser) errorf(format string, args ...any) error {
+	return fmt.Errorf("%s at position %d", fmt.Sprintf(format, args...), p.pos+1)
+}
@@ -0,0 +1,128 @@
+package speedtester
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFilterExpression(t *testing.T) {
+	tests := []struct {
+		expr       string
+		ignoreCase bool
+		name       string
+		want       bool
+	}{
+		{expr: "HK", name: "HK 01", want: true},
+		{expr: "HK", name: "hk 01", want: false},
+		{expr: "HK", ignoreCase: true, name: "hk 01", want: true},
+		{expr: "/hk/i", name: "HK 01", want: true},
+		{expr: "!HK", name: "HK 01", want: false},
+		{expr: "!!HK", name: "HK 01", want: true},
+		// && 优先于 ||
+		{expr: "HK || SG && IPLC", name: "HK 01", want: true},
+		{expr: "HK || SG && IPLC", name: "SG 01", want: false},
+		{expr: "(HK || SG) && IPLC", name: "HK 01", want: false},
+		{expr: "(HK || SG) && IPLC", name: "SG IPLC", want: true},
+		// ! 优先于 &&
+		{expr: "!HK && SG", name: "SG 01", want: true},
+		{expr: "!(HK && SG)", name: "HK SG", want: false},
+		{expr: "/a b/ && c", name: "a b c", want: true},
+		{expr: `/a\/b/`, name: "a/b", want: true},
+		{expr: "/HK|港/ && !/IPLC|IEPL/i", name: "港 iepl", want: false},
+		{expr: "/HK|港/ && !/IPLC|IEPL/i", name: "港 01", want: true},
+		{expr: "x0\\.5", name: "x0_5", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr+"/"+tt.name, func(t *testing.T) {
+			filter, err := ParseNameFilter(nil, nil, tt.expr, tt.ignoreCase)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := filter.Check(tt.name) == ""; got != tt.want {
+				t.Errorf("match = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFilterExpressionErrors(t *testing.T) {
+	tests := []struct {
+		expr string
+		want string
+	}{
+		{expr: "/HK", want: "unterminated pattern at position 1"},
+		{expr: "HK &&", want: "missing pattern"},
+		{expr: "&& HK", want: "unexpected '&'"},
+		{expr: "()", want: "unexpected ')'"},
+		{expr: "(HK", want: "missing )"},
+		{expr: "HK)", want: "unexpected ')' at position 3"},
+		{expr: "HK SG", want: "unexpected 'S' at position 4"},
+		{expr: "/(/", want: `pattern "(" at position 1`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			_, err := ParseNameFilter(nil, nil, tt.expr, false)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("err = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestExcludeKeywords(t *testing.T) {
+	tests := []struct {
+		pattern string
+		name    string
+		want    bool
+	}{
+		{pattern: "倍率|x1|0.5x", name: "HK 0.5x", want: true},
+		{pattern: "倍率|x1|0.5x", name: "HK 0_5x", want: false},
+		{pattern: "倍率|X1", name: "hk x1", want: true},
+		{pattern: "c++|(test)|[a]", name: "node (test)", want: true},
+		{pattern: "c++|(test)|[a]", name: "node a", want: false},
+		{pattern: " 试用 | ", name: "试用节点", want: true},
+		{pattern: `/x0\.[0-5]/`, name: "X0.3", want: true},
+		{pattern: `/x0\.[0-5]/`, name: "x0.8", want: false},
+		{pattern: `/a\/b/i`, name: "A/B", want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.pattern+"/"+tt.name, func(t *testing.T) {
+			filter, err := ParseNameFilter(nil, []string{tt.pattern}, "", false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := filter.Check(tt.name) != ""; got != tt.want {
+				t.Errorf("excluded = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := ParseNameFilter(nil, []string{"/(/"}, "", false); err == nil {
+		t.Error("invalid exclude regexp should fail")
+	}
+	if filter, _ := ParseNameFilter(nil, []string{" | "}, "", false); filter != nil {
+		t.Error("blank keywords should not create a filter")
+	}
+}
+
+func TestNameFilterCheckReason(t *testing.T) {
+	filter, err := ParseNameFilter([]string{"HK", "SG"}, []string{"试用", "倍率|x0."}, "!IPLC", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		want string
+	}{
+		{name: "HK 01", want: ""},
+		{name: "HK 试用", want: "匹配排除规则 -b '试用'"},
+		{name: "SG x0.5", want: "匹配排除规则 -b '倍率|x0.'"},
+		{name: "JP 01", want: "不匹配任何包含规则 -f"},
+		{name: "HK IPLC", want: "不满足表达式 -filter '!IPLC'"},
+	}
+	for _, tt := range tests {
+		if got := filter.Check(tt.name); got != tt.want {
+			t.Errorf("Check(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package speedtester
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// 分阶段测试中节点到达的阶段
+const (
+	StageLatency = "延迟"
+	StageSpeed   = "测速"
+	StageUnlock  = "解锁"
+)
+
+// StageSummary 记录分阶段测试中每个阶段的筛选情况
+type StageSummary struct {
+	Name   string
+	Tested int    // 进入该阶段的节点数
+	Passed int    // 通过该阶段筛选、进入下一阶段的节点数
+	Cutoff string // 筛选条件
+}
+
+func (s StageSummary) String() string {
+	if s.Cutoff == "" {
+		return fmt.Sprintf("%s: 测试 %d 个节点", s.Name, s.Tested)
+	}
+	return fmt.Sprintf("%s: 测试 %d 个节点，%d 个通过(%s)", s.Name, s.Tested, s.Passed, s.Cutoff)
+}
+
+// StageSummaries 返回分阶段测试各阶段的筛选情况
+func (st *SpeedTester) StageSummaries() []StageSummary {
+	return st.stages
+}
+
+type pipelineJob struct {
+	name   string
+	proxy  *CProxy
+	result *Result
+}
+
+// testPipeline 分阶段测试：先测试所有节点的延迟，再对延迟最低的前 K 个或低于 MaxLatency 的节点测速，
+// 启用解锁检测时只检测速度不低于 MinSpeed 的节点，未进入下一阶段的节点在被筛掉时立即输出
+func (st *SpeedTester) testPipeline(proxies map[string]*CProxy, report func(result *Result)) {
+	// 1. 所有节点测试延迟
+	var candidates []*pipelineJob
+	for name, proxy := range proxies {
+		result := st.testLatencyPhase(name, proxy)
+		result.Stage = StageLatency
+		switch {
+		case !result.Reachable():
+			result.StageNote = "延迟测试失败"
+		case st.config.MaxLatency > 0 && result.Latency >= st.config.MaxLatency:
+			result.StageNote = fmt.Sprintf("延迟 >= %s", st.config.MaxLatency)
+		default:
+			candidates = append(candidates, &pipelineJob{name: name, proxy: proxy, result: result})
+			continue
+		}
+		report(result)
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].result.Latency < candidates[j].result.Latency
+	})
+	if st.config.TopK > 0 && len(candidates) > st.config.TopK {
+		for _, job := range candidates[st.config.TopK:] {
+			job.result.StageNote = fmt.Sprintf("延迟未进入前 %d", st.config.TopK)
+			report(job.result)
+		}
+		candidates = candidates[:st.config.TopK]
+	}
+	st.stages = append(st.stages, StageSummary{
+		Name:   StageLatency,
+		Tested: len(proxies),
+		Passed: len(candidates),
+		Cutoff: latencyCutoff(st.config.MaxLatency, st.config.TopK),
+	})
+
+	// 2. 对通过延迟筛选的节点测速
+	var unlockCandidates []*pipelineJob
+	for _, job := range candidates {
+		result := job.result
+		result.Stage = StageSpeed
+		if st.config.EnableUDP {
+			result.UDP = st.testUDP(job.proxy)
+		}
+		if st.config.EnableDNS {
+			result.DNS = st.testDNS(job.proxy)
+		}
+		if result.Group != nil {
+			st.testFailover(job.proxy, result)
+		}
+		st.testSpeedPhase(job.proxy, result)
+		if len(st.config.Targets) > 0 {
+			st.testTargets(job.proxy, result)
+		}
+
+		if !st.config.EnableUnlock {
+			report(result)
+			continue
+		}
+		if st.config.MinSpeed > 0 && result.DownloadSpeed/(1024*1024) < st.config.MinSpeed {
+			result.StageNote = fmt.Sprintf("速度 < %.2fMB/s", st.config.MinSpeed)
+			report(result)
+			continue
+		}
+		unlockCandidates = append(unlockCandidates, job)
+	}
+	speedSummary := StageSummary{Name: StageSpeed, Tested: len(candidates), Passed: len(candidates)}
+	if st.config.EnableUnlock {
+		speedSummary.Passed = len(unlockCandidates)
+		speedSummary.Cutoff = "全部通过"
+		if st.config.MinSpeed > 0 {
+			speedSummary.Cutoff = fmt.Sprintf("下载速度 >= %.2fMB/s", st.config.MinSpeed)
+		}
+	}
+	st.stages = append(st.stages, speedSummary)
+
+	if !st.config.EnableUnlock {
+		return
+	}
+
+	// 3. 对速度达标的节点检测解锁
+	for _, job := range unlockCandidates {
+		job.result.Stage = StageUnlock
+		st.testUnlockPhase(job.name, job.proxy, job.result)
+		report(job.result)
+	}
+	st.stages = append(st.stages, StageSummary{Name: StageUnlock, Tested: len(unlockCandidates)})
+}
+
+func latencyCutoff(maxLatency time.Duration, topK int) string {
+	switch {
+	case maxLatency > 0 && topK > 0:
+		return fmt.Sprintf("延迟 < %s 且最低的前 %d 个", maxLatency, topK)
+	case maxLatency > 0:
+		return fmt.Sprintf("延迟 < %s", maxLatency)
+	case topK > 0:
+		return fmt.Sprintf("延迟最低的前 %d 个", topK)
+	default:
+		return "延迟测试成功"
+	}
+}
+
+// StageColumn 显示节点在分阶段测试中到达的阶段及被筛掉的原因
+var StageColumn = Column{Name: "stage", Header: "阶段", Value: func(r *Result) string {
+	if r.StageNote == "" {
+		return r.Stage
+	}
+	return r.Stage + "\n" + r.StageNote
+}}
@@ -0,0 +1,77 @@
+package speedtester
+
+import (
+	"encoding/binary"
+	"io"
+)
+
+// PayloadSeedHeader 上传请求中携带随机数据种子的请求头，download-server 据此校验上传内容
+const PayloadSeedHeader = "X-Payload-Seed"
+
+// RandomReader 使用 xorshift64* 生成不可压缩的伪随机数据，相同种子和长度生成的内容相同，读取时不分配内存
+type RandomReader struct {
+	state        uint64
+	word         uint64 // 当前 8 字节中尚未输出的部分
+	wordBytes    int
+	remainBytes  int64
+	writtenBytes int64
+}
+
+func NewRandomReader(seed uint64, size int) *RandomReader {
+	// xorshift 的状态不能为 0
+	if seed == 0 {
+		seed = 0x9e3779b97f4a7c15
+	}
+	return &RandomReader{
+		state:       seed,
+		remainBytes: int64(size),
+	}
+}
+
+func (r *RandomReader) next() uint64 {
+	r.state ^= r.state >> 12
+	r.state ^= r.state << 25
+	r.state ^= r.state >> 27
+	return r.state * 0x2545f4914f6cdd1d
+}
+
+func (r *RandomReader) Read(p []byte) (n int, err error) {
+	if r.remainBytes <= 0 {
+		return 0, io.EOF
+	}
+	if int64(len(p)) > r.remainBytes {
+		p = p[:r.remainBytes]
+	}
+
+	// 先输出上次剩下的字节，保证任意分块读取得到的内容一致
+	for n < len(p) && r.wordBytes > 0 {
+		p[n] = byte(r.word)
+		r.word >>= 8
+		r.wordBytes--
+		n++
+	}
+	for ; n+8 <= len(p); n += 8 {
+		binary.LittleEndian.PutUint64(p[n:], r.next())
+	}
+	if n < len(p) {
+		r.word, r.wordBytes = r.next(), 8
+		for n < len(p) {
+			p[n] = byte(r.word)
+			r.word >>= 8
+			r.wordBytes--
+			n++
+		}
+	}
+
+	r.remainBytes -= int64(n)
+	r.writtenBytes += int64(n)
+	return n, nil
+}
+
+func (r *RandomReader) WrittenBytes() int64 {
+	return r.writtenBytes
+}
+
+func (r *RandomReader) RemainBytes() int64 {
+	return r.remainBytes
+}
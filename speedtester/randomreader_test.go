@@ -0,0 +1,91 @@
+package speedtester
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"testing/iotest"
+)
+
+// readChunks 每次最多读取 chunk 字节，返回读到的全部内容
+func readChunks(t *testing.T, r io.Reader, chunk int) []byte {
+	t.Helper()
+	var out []byte
+	buf := make([]byte, chunk)
+	for {
+		n, err := r.Read(buf)
+		out = append(out, buf[:n]...)
+		if err == io.EOF {
+			return out
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestRandomReaderChunks(t *testing.T) {
+	const seed, size = 42, 1000
+	want, err := io.ReadAll(NewRandomReader(seed, size))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(want) != size {
+		t.Fatalf("read %d bytes, want %d", len(want), size)
+	}
+
+	for _, chunk := range []int{1, 3, 7, 8, 9, 13, 64, 999, 4096} {
+		if got := readChunks(t, NewRandomReader(seed, size), chunk); !bytes.Equal(got, want) {
+			t.Errorf("chunk size %d produced different data", chunk)
+		}
+	}
+
+	// 交替使用不同的分块大小，跨越 8 字节边界
+	reader := NewRandomReader(seed, size)
+	var got []byte
+	for i := 0; reader.RemainBytes() > 0; i++ {
+		buf := make([]byte, 1+i%11)
+		n, _ := reader.Read(buf)
+		got = append(got, buf[:n]...)
+	}
+	if !bytes.Equal(got, want) || reader.WrittenBytes() != size {
+		t.Errorf("mixed chunk sizes produced different data, written %d", reader.WrittenBytes())
+	}
+	if n, err := reader.Read(make([]byte, 8)); n != 0 || err != io.EOF {
+		t.Errorf("read after end = %d, %v, want 0, EOF", n, err)
+	}
+
+	if err := iotest.TestReader(NewRandomReader(seed, size), want); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestRandomReaderSeed(t *testing.T) {
+	a, _ := io.ReadAll(NewRandomReader(1, 256))
+	b, _ := io.ReadAll(NewRandomReader(2, 256))
+	if bytes.Equal(a, b) {
+		t.Error("different seeds produced the same data")
+	}
+	// 种子为 0 时使用固定的非零状态，不会输出全 0
+	zero, _ := io.ReadAll(NewRandomReader(0, 256))
+	if bytes.Equal(zero, make([]byte, 256)) {
+		t.Error("seed 0 produced all zero data")
+	}
+}
+
+func TestRandomReaderUploadCheck(t *testing.T) {
+	// 客户端通过 HTTP 分块上传，download-server 按收到的字节数用同一个种子重新生成数据校验
+	const seed, size = 0xdeadbeef, 100000
+	sent := readChunks(t, iotest.HalfReader(NewRandomReader(seed, size)), 1500)
+	for _, received := range []int{size, size - 1, 12345, 1} {
+		expected, _ := io.ReadAll(NewRandomReader(seed, received))
+		if !bytes.Equal(sent[:received], expected) {
+			t.Errorf("server regenerated %d bytes do not match client payload", received)
+		}
+	}
+
+	other, _ := io.ReadAll(NewRandomReader(seed+1, size))
+	if bytes.Equal(sent, other) {
+		t.Error("payload with a different seed should not match")
+	}
+}
@@ -2,16 +2,16 @@ package speedtester
 
 import (
 	"context"
+	"crypto/tls"
 	"fmt"
 	"io"
-	"math"
+	"math/rand"
 	"net"
 	"net/http"
 	"os"
-	"regexp"
+	"sort"
 	"strconv"
 	"strings"
-	"sync"
 	"time"
 
 	"reporter"
@@ -20,33 +20,73 @@ import (
 	"github.com/metacubex/mihomo/adapter"
 	"github.com/metacubex/mihomo/adapter/provider"
 	"github.com/metacubex/mihomo/constant"
+	types "github.com/metacubex/mihomo/constant/provider"
 	"github.com/metacubex/mihomo/log"
+	"github.com/metacubex/mihomo/tunnel"
 	"gopkg.in/yaml.v3"
 )
 
 type Config struct {
 	ConfigPaths      string
-	FilterRegex      string
-	BlockRegex       string
+	NameFilter       *NameFilter
 	ServerURL        string
 	DownloadSize     int
 	UploadSize       int
 	Timeout          time.Duration
 	Concurrent       int
 	EnableUnlock     bool
+	UnlockSpeed      bool // 启用解锁检测时同时测试下载和上传速度
 	UnlockConcurrent int
 	DebugMode        bool
 	EnableRisk       bool
 	HTMLReport       string
 	OutputPath       string
 	FastMode         bool
+	UnlockRecordDir  string
+	UnlockShare      bool
+	UnlockCachePath  string
+	UnlockCacheTTL   time.Duration
+	GeoProviders     []unlock.GeoProvider
+	GeoMode          string
+	RiskProviders    []unlock.RiskProvider
+	TestDuration     time.Duration
+	Warmup           time.Duration
+	TCPPing          bool
+	PingCount        int
+	PingInterval     time.Duration
+	EnableUDP        bool
+	UDPEchoServer    string
+	Backend          SpeedBackend
+	Targets          []Target
+	ServerInsecure   bool
+	TrafficBudget    int64
+	NodeTrafficCap   int64
+	Pipeline         bool
+	TopK             int
+	MaxLatency       time.Duration
+	MinSpeed         float64 // MB/s
+	DetectExitIP     bool
+	TestIPStack      bool
+	EnableDNS        bool
+	Via              string // 所有测试先经过的前置代理，节点名称或 socks5/http 代理地址
+	Interface        string // 连接节点服务器使用的网卡
+	SourceIP         string // 连接节点服务器使用的源地址
+	TestGroups       bool   // 将 url-test/fallback/load-balance 代理组作为整体测试
+	NodeFilter       *NodeFilter
 }
 
 type SpeedTester struct {
-	config           *Config
-	debugMode        bool
-	blockedNodes     []string
-	blockedNodeCount int
+	config        *Config
+	debugMode     bool
+	unlockCache   *unlockCache
+	traffic       *trafficBudget
+	stages        []StageSummary
+	localResolver *localResolver
+	viaName       string
+	viaProxy      constant.Proxy            // 前置代理，用于经过前置代理测量 TCP 延迟
+	proxyConfigs  map[string]map[string]any // 所有节点的原始配置，用于导出依赖的上游节点
+	groupConfigs  map[string]map[string]any // 代理组的原始配置
+	groupSources  map[string]*groupSource   // 重新创建代理组所需的节点和 provider
 }
 
 func New(config *Config, debugMode bool) *SpeedTester {
@@ -59,9 +99,17 @@ func New(config *Config, debugMode bool) *SpeedTester {
 	if config.UploadSize <= 0 {
 		config.UploadSize = 10 * 1024 * 1024
 	}
+	if config.PingCount <= 0 {
+		config.PingCount = 6
+	}
+	if config.Backend == nil {
+		config.Backend = &cloudflareBackend{name: BackendCloudflare, baseURL: strings.TrimSuffix(config.ServerURL, "/"), latencyPath: "/__down?bytes=0"}
+	}
 	return &SpeedTester{
-		config:    config,
-		debugMode: debugMode,
+		config:        config,
+		debugMode:     debugMode,
+		traffic:       &trafficBudget{limit: config.TrafficBudget},
+		localResolver: &localResolver{},
 	}
 }
 
@@ -71,14 +119,29 @@ type CProxy struct {
 }
 
 type RawConfig struct {
-	Providers map[string]map[string]any `yaml:"proxy-providers"`
-	Proxies   []map[string]any          `yaml:"proxies"`
+	Providers   map[string]map[string]any `yaml:"proxy-providers"`
+	Proxies     []map[string]any          `yaml:"proxies"`
+	ProxyGroups []map[string]any          `yaml:"proxy-groups,omitempty"`
 }
 
 func (st *SpeedTester) LoadProxies() (map[string]*CProxy, error) {
 	allProxies := make(map[string]*CProxy)
-	st.blockedNodes = make([]string, 0)
-	st.blockedNodeCount = 0
+	st.proxyConfigs = make(map[string]map[string]any)
+	st.groupConfigs = make(map[string]map[string]any)
+	st.groupSources = make(map[string]*groupSource)
+
+	// dialer-proxy 和 relay 代理组在建立连接时按名称从 tunnel 中查找上游节点
+	registry := builtinProxies()
+	if st.config.Via != "" {
+		viaName, viaProxy, err := st.parseVia(st.config.Via)
+		if err != nil {
+			return nil, err
+		}
+		st.viaName = viaName
+		if viaProxy != nil {
+			registry[viaName] = viaProxy
+		}
+	}
 
 	for _, configPath := range strings.Split(st.config.ConfigPaths, ",") {
 		var body []byte
@@ -108,42 +171,114 @@ func (st *SpeedTester) LoadProxies() (map[string]*CProxy, error) {
 		proxies := make(map[string]*CProxy)
 		proxiesConfig := rawCfg.Proxies
 		providersConfig := rawCfg.Providers
+		proxyMap := make(map[string]constant.Proxy)
+		directMap := make(map[string]constant.Proxy) // 不经过前置代理的节点，用于 relay 代理组中除第一跳以外的节点
+		proxyNames := make([]string, 0, len(proxiesConfig))
 
 		for i, config := range proxiesConfig {
-			proxy, err := adapter.ParseProxy(config)
+			proxy, err := adapter.ParseProxy(st.withDialOptions(st.withVia(config)))
 			if err != nil {
 				return nil, fmt.Errorf("proxy %d: %w", i, err)
 			}
+			proxy = st.bindProxy(proxy)
 
 			if _, exist := proxies[proxy.Name()]; exist {
 				return nil, fmt.Errorf("proxy %s is the duplicate name", proxy.Name())
 			}
 			proxies[proxy.Name()] = &CProxy{Proxy: proxy, Config: config}
+			proxyMap[proxy.Name()] = proxy
+			proxyNames = append(proxyNames, proxy.Name())
+			if st.viaName != "" {
+				if direct, err := adapter.ParseProxy(st.withDialOptions(config)); err == nil {
+					directMap[direct.Name()] = st.bindProxy(direct)
+				}
+			}
+			if _, exist := st.proxyConfigs[proxy.Name()]; !exist {
+				st.proxyConfigs[proxy.Name()] = config
+			}
 		}
+		providersMap := make(map[string]types.ProxyProvider)
+		providerNames := make([]string, 0, len(providersConfig))
 		for name, config := range providersConfig {
 			if name == provider.ReservedName {
 				return nil, fmt.Errorf("can not defined a provider called `%s`", provider.ReservedName)
 			}
-			pd, err := provider.ParseProxyProvider(name, config)
+			pd, err := provider.ParseProxyProvider(name, st.withProviderDialOptions(st.withVia(config)))
 			if err != nil {
 				return nil, fmt.Errorf("parse proxy provider %s error: %w", name, err)
 			}
 			if err := pd.Initial(); err != nil {
 				return nil, fmt.Errorf("initial proxy provider %s error: %w", pd.Name(), err)
 			}
+			providersMap[name] = pd
+			providerNames = append(providerNames, name)
 			for _, proxy := range pd.Proxies() {
+				proxy = st.bindProxy(proxy)
 				proxies[fmt.Sprintf("[%s] %s", name, proxy.Name())] = &CProxy{
 					Proxy:  proxy,
 					Config: config,
 				}
+				if _, exist := proxyMap[proxy.Name()]; !exist {
+					proxyMap[proxy.Name()] = proxy
+				}
+			}
+		}
+
+		// 按依赖顺序解析代理组：relay 代理组按顺序经过组内的每个节点，url-test/fallback/load-balance
+		// 代理组按客户端的方式选择节点，都作为一个整体测试；其他代理组只用于被引用
+		for name, proxy := range builtinProxies() {
+			proxyMap[name] = proxy
+		}
+		baseProviders := make(map[string]types.ProxyProvider, len(providersMap))
+		for name, pd := range providersMap {
+			baseProviders[name] = pd
+		}
+		pending := rawCfg.ProxyGroups
+		for len(pending) > 0 {
+			var waiting []map[string]any
+			for _, config := range pending {
+				if !groupReady(config, proxyMap) {
+					waiting = append(waiting, config)
+					continue
+				}
+				source := &groupSource{config: config, proxyMap: proxyMap, providersMap: baseProviders, proxyNames: proxyNames, providerNames: providerNames}
+				groupMap := proxyMap
+				if config["type"] == "relay" {
+					groupMap = st.relayProxyMap(config, proxyMap, directMap)
+				}
+				proxy, err := source.parseGroup(groupMap)
+				if err != nil {
+					log.Warnln("parse proxy group %v failed: %s", config["name"], err)
+					continue
+				}
+				proxies[proxy.Name()] = &CProxy{Proxy: proxy, Config: config}
+				proxyMap[proxy.Name()] = proxy
+				if _, exist := st.groupConfigs[proxy.Name()]; !exist {
+					st.groupConfigs[proxy.Name()] = config
+					st.groupSources[proxy.Name()] = source
+				}
+			}
+			// 剩余的代理组引用了不存在的节点或存在循环引用
+			if len(waiting) == len(pending) {
+				for _, config := range waiting {
+					log.Warnln("parse proxy group %v failed: missing or circular proxies", config["name"])
+				}
+				break
 			}
+			pending = waiting
 		}
+		for name, proxy := range proxyMap {
+			if _, exist := registry[name]; !exist {
+				registry[name] = proxy
+			}
+		}
+
 		for k, p := range proxies {
-			switch p.Type() {
-			case constant.Shadowsocks, constant.ShadowsocksR, constant.Snell, constant.Socks5, constant.Http,
-				constant.Vmess, constant.Vless, constant.Trojan, constant.Hysteria, constant.Hysteria2,
-				constant.WireGuard, constant.Tuic, constant.Ssh, constant.AnyTLS:
-			default:
+			if !st.testableType(p.Type()) {
+				continue
+			}
+			// 前置代理本身不参与测试
+			if st.viaName != "" && k == st.viaName {
 				continue
 			}
 			if _, ok := allProxies[k]; !ok {
@@ -152,60 +287,43 @@ func (st *SpeedTester) LoadProxies() (map[string]*CProxy, error) {
 		}
 	}
 
-	filterRegexp := regexp.MustCompile(st.config.FilterRegex)
-
-	// 处理屏蔽关键词
-	var blockKeywords []string
-	if st.config.BlockRegex != "" {
-		// 分割关键词，去除空格
-		for _, keyword := range strings.Split(st.config.BlockRegex, "|") {
-			keyword = strings.TrimSpace(keyword)
-			if keyword != "" {
-				blockKeywords = append(blockKeywords, strings.ToLower(keyword))
-			}
+	if st.viaName != "" {
+		if _, ok := registry[st.viaName]; !ok {
+			return nil, fmt.Errorf("via proxy %s not found", st.viaName)
 		}
+		st.viaProxy = registry[st.viaName]
 	}
+	tunnel.UpdateProxies(registry, nil)
 
 	// 记录总节点数
 	totalNodes := len(allProxies)
 
+	// 先按名称筛选，再按协议、服务器、端口、传输方式和 TLS 筛选，记录每个节点被筛掉的原因
 	filteredProxies := make(map[string]*CProxy)
+	var excludedNodes []string
 	for name, proxy := range allProxies {
-		// 检查是否包含屏蔽关键词
-		shouldBlock := false
-		if len(blockKeywords) > 0 {
-			lowerName := strings.ToLower(name)
-			for _, keyword := range blockKeywords {
-				if strings.Contains(lowerName, keyword) {
-					if st.debugMode {
-						st.blockedNodes = append(st.blockedNodes, fmt.Sprintf("%s (匹配关键词: %s)", name, keyword))
-						st.blockedNodeCount++
-					}
-					shouldBlock = true
-					break
-				}
-			}
+		reason := st.config.NameFilter.Check(name)
+		if reason == "" {
+			reason = st.config.NodeFilter.Check(proxy)
 		}
-
-		if shouldBlock {
+		if reason != "" {
+			excludedNodes = append(excludedNodes, fmt.Sprintf("%s (%s)", name, reason))
 			continue
 		}
-
-		if filterRegexp.MatchString(name) {
-			filteredProxies[name] = proxy
-		}
+		filteredProxies[name] = proxy
 	}
 
-	// 在Debug模式下输出屏蔽信息
-	if st.debugMode && len(blockKeywords) > 0 {
+	// 在Debug模式下输出筛选信息
+	if st.debugMode && (st.config.NameFilter != nil || st.config.NodeFilter != nil) {
 		fmt.Printf("\n[Debug] 节点统计信息:\n")
 		fmt.Printf("[Debug] 总节点数: %d\n", totalNodes)
-		fmt.Printf("[Debug] 已屏蔽节点数: %d\n", st.blockedNodeCount)
+		fmt.Printf("[Debug] 已排除节点数: %d\n", len(excludedNodes))
 		fmt.Printf("[Debug] 剩余节点数: %d\n", len(filteredProxies))
-		if st.blockedNodeCount > 0 {
-			fmt.Printf("\n[Debug] 被屏蔽的节点:\n")
-			for _, name := range st.blockedNodes {
-				fmt.Printf("[Debug] - %s\n", name)
+		if len(excludedNodes) > 0 {
+			sort.Strings(excludedNodes)
+			fmt.Printf("\n[Debug] 被排除的节点:\n")
+			for _, node := range excludedNodes {
+				fmt.Printf("[Debug] - %s\n", node)
 			}
 		}
 		fmt.Println()
@@ -222,6 +340,7 @@ func (st *SpeedTester) TestProxies(proxies map[string]*CProxy, fn func(result *R
 		htmlReporter, err = reporter.NewHTMLReporter(
 			st.config.HTMLReport,
 			st.config.EnableUnlock,
+			st.speedEnabled(),
 			st.config.ConfigPaths,
 			len(proxies),
 			st.config.OutputPath,
@@ -233,9 +352,20 @@ func (st *SpeedTester) TestProxies(proxies map[string]*CProxy, fn func(result *R
 		}
 	}
 
-	for name, proxy := range proxies {
-		result := st.testProxy(name, proxy)
+	if st.config.EnableUnlock && (st.config.UnlockShare || st.config.UnlockCachePath != "") {
+		st.unlockCache, err = newUnlockCache(st.config.UnlockCachePath, st.config.UnlockCacheTTL)
+		if err != nil {
+			log.Warnln("加载解锁缓存失败: %v", err)
+			st.unlockCache, _ = newUnlockCache("", st.config.UnlockCacheTTL)
+		}
+		defer func() {
+			if err := st.unlockCache.save(); err != nil {
+				log.Warnln("保存解锁缓存失败: %v", err)
+			}
+		}()
+	}
 
+	report := func(result *Result) {
 		if htmlReporter != nil {
 			// 转换结果为 HTML 报告格式
 			htmlResult := &reporter.Result{
@@ -252,8 +382,9 @@ func (st *SpeedTester) TestProxies(proxies map[string]*CProxy, fn func(result *R
 				htmlResult.JitterValue = result.Jitter.Milliseconds()
 				htmlResult.PacketLoss = result.FormatPacketLoss()
 				htmlResult.PacketLossValue = result.PacketLoss
-				htmlResult.Location = reporter.FormatLocation(result.FormatLocation())
+				htmlResult.Location = reporter.FormatLocation(result.Location, result.reporterRisk())
 				htmlResult.StreamUnlock = result.FormatStreamUnlock()
+				htmlResult.UnlockShared = result.UnlockShared
 				htmlResult.UnlockPlatforms = reporter.ParseStreamUnlock(result.FormatStreamUnlock())
 				htmlResult.DownloadSpeed = result.FormatDownloadSpeed()
 				htmlResult.DownloadSpeedMB = result.DownloadSpeed / (1024 * 1024)
@@ -269,6 +400,20 @@ func (st *SpeedTester) TestProxies(proxies map[string]*CProxy, fn func(result *R
 		// 回调函数在最后调用，确保 HTML 报告已更新
 		fn(result)
 	}
+
+	if st.config.Pipeline {
+		st.testPipeline(proxies, report)
+		return
+	}
+
+	for name, proxy := range proxies {
+		result := st.testProxy(name, proxy)
+		// 主测速服务器延迟测试失败时节点基本不可用，不再测试其他目标
+		if len(st.config.Targets) > 0 && result.Latency > 0 {
+			st.testTargets(proxy, result)
+		}
+		report(result)
+	}
 }
 
 type testJob struct {
@@ -277,26 +422,124 @@ type testJob struct {
 }
 
 type Result struct {
-	ProxyName     string         `json:"proxy_name"`
-	ProxyType     string         `json:"proxy_type"`
-	ProxyConfig   map[string]any `json:"proxy_config"`
-	Latency       time.Duration  `json:"latency"`
-	Jitter        time.Duration  `json:"jitter"`
-	PacketLoss    float64        `json:"packet_loss"`
-	DownloadSize  float64        `json:"download_size"`
-	DownloadTime  time.Duration  `json:"download_time"`
-	DownloadSpeed float64        `json:"download_speed"`
-	UploadSize    float64        `json:"upload_size"`
-	UploadTime    time.Duration  `json:"upload_time"`
-	UploadSpeed   float64        `json:"upload_speed"`
-	Location      string         `json:"location"`
-	StreamUnlock  string         `json:"stream_unlock"`
+	ProxyName             string           `json:"proxy_name"`
+	ProxyType             string           `json:"proxy_type"`
+	ProxyConfig           map[string]any   `json:"proxy_config"`
+	Latency               time.Duration    `json:"latency"`
+	Jitter                time.Duration    `json:"jitter"`
+	DialLatency           time.Duration    `json:"dial_latency"`
+	TLSLatency            time.Duration    `json:"tls_latency"`
+	TTFB                  time.Duration    `json:"ttfb"`
+	TCPLatency            time.Duration    `json:"tcp_latency"`
+	ColdLatency           time.Duration    `json:"cold_latency"`
+	LatencyMin            time.Duration    `json:"latency_min"`
+	LatencyMedian         time.Duration    `json:"latency_median"`
+	LatencyP90            time.Duration    `json:"latency_p90"`
+	LatencyP99            time.Duration    `json:"latency_p99"`
+	LatencyMax            time.Duration    `json:"latency_max"`
+	PacketLoss            float64          `json:"packet_loss"`
+	DownloadSize          float64          `json:"download_size"`
+	DownloadTime          time.Duration    `json:"download_time"`
+	DownloadSpeed         float64          `json:"download_speed"`
+	UploadSize            float64          `json:"upload_size"`
+	UploadTime            time.Duration    `json:"upload_time"`
+	UploadSpeed           float64          `json:"upload_speed"`
+	DownloadPeak          float64          `json:"download_peak"`
+	UploadPeak            float64          `json:"upload_peak"`
+	DownloadSamples       []float64        `json:"download_samples,omitempty"`
+	UploadSamples         []float64        `json:"upload_samples,omitempty"`
+	DownloadFailedStreams int              `json:"download_failed_streams"`
+	DownloadFailedBytes   int64            `json:"download_failed_bytes"`
+	UploadFailedStreams   int              `json:"upload_failed_streams"`
+	UploadFailedBytes     int64            `json:"upload_failed_bytes"`
+	DownloadMismatches    int              `json:"download_mismatches,omitempty"` // 服务端统计的字节数与客户端不一致的请求数
+	UploadMismatches      int              `json:"upload_mismatches,omitempty"`
+	Location              string           `json:"location"`
+	Risk                  *unlock.RiskInfo `json:"risk"`
+	StreamUnlock          string           `json:"stream_unlock"`
+	ExitIP                string           `json:"exit_ip"`
+	ExitIPv4              string           `json:"exit_ipv4,omitempty"`
+	ExitIPv6              string           `json:"exit_ipv6,omitempty"`
+	ExitGroup             int              `json:"exit_group,omitempty"` // 出口 IP 相同的节点分组编号，从 1 开始
+	ExitGroupSize         int              `json:"exit_group_size,omitempty"`
+	Duplicate             bool             `json:"duplicate,omitempty"` // 同组中有表现更好的节点
+	DNS                   *DNSResult       `json:"dns,omitempty"`
+	IPStack               *IPStackResult   `json:"ip_stack,omitempty"`
+	Group                 *GroupResult     `json:"group,omitempty"`
+	GeoProvider           string           `json:"geo_provider"`
+	Country               string           `json:"country"`
+	City                  string           `json:"city"`
+	ASN                   uint             `json:"asn"`
+	Organization          string           `json:"organization"`
+	UnlockShared          string           `json:"unlock_shared"`
+	UDP                   *UDPResult       `json:"udp,omitempty"`
+	Targets               []TargetResult   `json:"targets,omitempty"`
+	TrafficBytes          int64            `json:"traffic_bytes"`
+	TrafficCapped         bool             `json:"traffic_capped"`
+	TrafficSkipped        bool             `json:"traffic_skipped"`
+	Stage                 string           `json:"stage,omitempty"`
+	StageNote             string           `json:"stage_note,omitempty"`
 }
 
 func (r *Result) FormatDownloadSpeed() string {
 	return formatSpeed(r.DownloadSpeed)
 }
 
+// FormatDownloadPeak 返回下载峰值速度，仅在按时长测速时有值
+func (r *Result) FormatDownloadPeak() string {
+	if r.DownloadPeak == 0 {
+		return ""
+	}
+	return formatSpeed(r.DownloadPeak)
+}
+
+// FormatUploadPeak 返回上传峰值速度，仅在按时长测速时有值
+func (r *Result) FormatUploadPeak() string {
+	if r.UploadPeak == 0 {
+		return ""
+	}
+	return formatSpeed(r.UploadPeak)
+}
+
+// FormatDownloadFailed 返回出错的下载连接数，没有连接出错时返回空字符串
+func (r *Result) FormatDownloadFailed(concurrent int) string {
+	return formatFailedStreams(r.DownloadFailedStreams, concurrent, r.DownloadFailedBytes)
+}
+
+// FormatUploadFailed 返回出错的上传连接数，没有连接出错时返回空字符串
+func (r *Result) FormatUploadFailed(concurrent int) string {
+	return formatFailedStreams(r.UploadFailedStreams, concurrent, r.UploadFailedBytes)
+}
+
+// FormatDownloadMismatch 返回服务端字节统计与客户端不一致的下载请求数，一致时返回空字符串
+func (r *Result) FormatDownloadMismatch() string {
+	return formatMismatches(r.DownloadMismatches)
+}
+
+// FormatUploadMismatch 返回服务端字节统计与客户端不一致的上传请求数，一致时返回空字符串
+func (r *Result) FormatUploadMismatch() string {
+	return formatMismatches(r.UploadMismatches)
+}
+
+func formatMismatches(n int) string {
+	if n == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%d 次字节数与服务端不一致", n)
+}
+
+func formatFailedStreams(failed, concurrent int, bytes int64) string {
+	if failed == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%d/%d 失败(%s)", failed, concurrent, formatBytes(bytes))
+}
+
+// Reachable 判断延迟测试是否成功
+func (r *Result) Reachable() bool {
+	return r.Latency > 0 && r.PacketLoss < 100
+}
+
 func (r *Result) FormatLatency() string {
 	if r.Latency == 0 {
 		return "N/A"
@@ -323,9 +566,40 @@ func (r *Result) FormatLocation() string {
 	if r.Location == "" {
 		return "N/A"
 	}
+	if r.Risk != nil {
+		return fmt.Sprintf("%s %s", r.Location, r.Risk.Format())
+	}
 	return r.Location
 }
 
+func (r *Result) reporterRisk() *reporter.Risk {
+	if r.Risk == nil {
+		return nil
+	}
+	return &reporter.Risk{
+		Score:  r.Risk.Score,
+		Type:   r.Risk.Type,
+		Proxy:  r.Risk.Proxy,
+		VPN:    r.Risk.VPN,
+		Source: r.Risk.Source,
+	}
+}
+
+// FormatNetwork 返回城市和 ASN 信息，仅在使用本地数据库时有值
+func (r *Result) FormatNetwork() string {
+	var parts []string
+	if r.City != "" {
+		parts = append(parts, r.City)
+	}
+	if r.ASN != 0 {
+		parts = append(parts, fmt.Sprintf("AS%d", r.ASN))
+	}
+	if r.Organization != "" {
+		parts = append(parts, r.Organization)
+	}
+	return strings.Join(parts, " ")
+}
+
 func (r *Result) FormatStreamUnlock() string {
 	if r.StreamUnlock == "" {
 		return "N/A"
@@ -344,22 +618,20 @@ func formatSpeed(bytesPerSecond float64) string {
 	return fmt.Sprintf("%.2f%s", speed, units[unit])
 }
 
-func (st *SpeedTester) testProxy(name string, proxy *CProxy) *Result {
-	result := &Result{
-		ProxyName:   name,
-		ProxyType:   proxy.Type().String(),
-		ProxyConfig: proxy.Config,
+func formatBytes(bytes int64) string {
+	units := []string{"B", "KB", "MB", "GB", "TB"}
+	unit := 0
+	size := float64(bytes)
+	for size >= 1024 && unit < len(units)-1 {
+		size /= 1024
+		unit++
 	}
+	return fmt.Sprintf("%.2f%s", size, units[unit])
+}
 
+func (st *SpeedTester) testProxy(name string, proxy *CProxy) *Result {
 	// 1. 先进行延迟测试
-	latencyResult := st.testLatency(proxy)
-	result.Latency = latencyResult.avgLatency
-
-	// 如果是快速模式，只测试延迟，不测试抖动和丢包率
-	if !st.config.FastMode {
-		result.Jitter = latencyResult.jitter
-		result.PacketLoss = latencyResult.packetLoss
-	}
+	result := st.testLatencyPhase(name, proxy)
 
 	// 如果是快速模式，只测试延迟，直接返回结果
 	if st.config.FastMode {
@@ -367,194 +639,305 @@ func (st *SpeedTester) testProxy(name string, proxy *CProxy) *Result {
 	}
 
 	// 如果延迟测试失败（延迟为0或丢包率为100%），直接返回结果
-	if result.Latency == 0 || result.PacketLoss == 100 {
+	if !result.Reachable() {
 		return result
 	}
 
-	client := st.createClient(proxy)
+	// UDP 探测不依赖 HTTP 测试，启用后在其他测试之前进行
+	if st.config.EnableUDP {
+		result.UDP = st.testUDP(proxy)
+	}
+	if st.config.EnableDNS {
+		result.DNS = st.testDNS(proxy)
+	}
+	if result.Group != nil {
+		st.testFailover(proxy, result)
+	}
 
-	// 2. 如果启用了解锁检测，进行地理位置和流媒体检测
+	// 2. 进行下载和上传测试，解锁模式下只在启用 UnlockSpeed 时测速
+	if st.speedEnabled() {
+		st.testSpeedPhase(proxy, result)
+	}
+
+	// 3. 如果启用了解锁检测，进行地理位置和流媒体检测
 	if st.config.EnableUnlock {
-		// 先获取地理位置和风险值
-		location, err := st.testLocation(client)
-		if err == nil {
-			result.Location = location
-		}
+		st.testUnlockPhase(name, proxy, result)
+	}
+	return result
+}
 
-		// 创建一个通道用于流媒体检测结果
-		streamChan := make(chan string, 1)
+// speedEnabled 返回是否测试下载和上传速度
+func (st *SpeedTester) speedEnabled() bool {
+	if st.config.FastMode {
+		return false
+	}
+	return !st.config.EnableUnlock || st.config.UnlockSpeed || st.config.Pipeline
+}
 
-		// 在后台进行流媒体检测
-		go func() {
-			streamChan <- unlock.TestAll(client, st.config.UnlockConcurrent, st.debugMode)
-		}()
+// testLatencyPhase 测试节点延迟并创建结果
+func (st *SpeedTester) testLatencyPhase(name string, proxy *CProxy) *Result {
+	result := &Result{
+		ProxyName:   name,
+		ProxyType:   proxy.Type().String(),
+		ProxyConfig: proxy.Config,
+	}
 
-		// 如果不需要测速，立即返回结果
-		if st.config.EnableUnlock {
-			// 等待流媒体检测结果
-			result.StreamUnlock = <-streamChan
-			return result
-		}
+	// 代理组先像客户端一样进行健康检查，再按选中的节点测试
+	if isTestedGroup(proxy.Type()) {
+		result.Group = st.testGroup(proxy)
 	}
 
-	// 3. 如果不是解锁模式，或者需要测试速度，进行下载和上传测试
-	if !st.config.EnableUnlock {
-		// 并发进行下载和上传测试
-		var wg sync.WaitGroup
-		downloadResults := make(chan *downloadResult, st.config.Concurrent)
+	latencyResult := st.testLatency(proxy)
+	result.Latency = latencyResult.avgLatency
+	result.DialLatency = latencyResult.dial
+	result.TLSLatency = latencyResult.tls
+	result.TTFB = latencyResult.ttfb
+	result.ColdLatency = latencyResult.cold
+	result.LatencyMin = latencyResult.min
+	result.LatencyMedian = latencyResult.median
+	result.LatencyP90 = latencyResult.p90
+	result.LatencyP99 = latencyResult.p99
+	result.LatencyMax = latencyResult.max
+	if st.config.TCPPing {
+		result.TCPLatency = st.testTCPLatency(proxy)
+	}
+	if st.config.DetectExitIP && latencyResult.avgLatency > 0 {
+		result.ExitIPv4, result.ExitIPv6 = st.testExitIP(proxy)
+	}
+	if st.config.TestIPStack && latencyResult.avgLatency > 0 {
+		st.testIPStack(proxy, result)
+	}
 
-		// 计算每个并发连接的数据大小
-		downloadChunkSize := st.config.DownloadSize / st.config.Concurrent
-		uploadChunkSize := st.config.UploadSize / st.config.Concurrent
+	// 如果是快速模式，只测试延迟，不测试抖动和丢包率
+	if !st.config.FastMode {
+		result.Jitter = latencyResult.jitter
+		result.PacketLoss = latencyResult.packetLoss
+	}
+	return result
+}
 
-		// 启动下载测试
-		for i := 0; i < st.config.Concurrent; i++ {
-			wg.Add(1)
-			go func() {
-				defer wg.Done()
-				downloadResults <- st.testDownload(proxy, downloadChunkSize)
-			}()
-		}
-		wg.Wait()
+// testSpeedPhase 进行下载和上传测试，按时长测速时在固定时间内测量稳定速度和峰值速度
+func (st *SpeedTester) testSpeedPhase(proxy *CProxy, result *Result) {
+	if st.config.TestDuration > 0 {
+		st.testSpeedDuration(proxy, result)
+	} else {
+		st.testSpeedFixed(proxy, result)
+	}
+}
 
-		uploadResults := make(chan *downloadResult, st.config.Concurrent)
+// testUnlockPhase 检测出口地理位置、IP 风险和流媒体解锁情况
+func (st *SpeedTester) testUnlockPhase(name string, proxy *CProxy, result *Result) {
+	client := st.createClient(proxy)
 
-		// 启动上传测试
-		for i := 0; i < st.config.Concurrent; i++ {
-			wg.Add(1)
-			go func() {
-				defer wg.Done()
-				uploadResults <- st.testUpload(proxy, uploadChunkSize)
-			}()
-		}
-		wg.Wait()
-
-		// 4. 汇总结果
-		var totalDownloadBytes, totalUploadBytes int64
-		var totalDownloadTime, totalUploadTime time.Duration
-		var downloadCount, uploadCount int
-
-		for i := 0; i < st.config.Concurrent; i++ {
-			if dr := <-downloadResults; dr != nil {
-				totalDownloadBytes += dr.bytes
-				totalDownloadTime += dr.duration
-				downloadCount++
+	// 记录解锁检测的 HTTP 交互，用于离线回放
+	if st.config.UnlockRecordDir != "" {
+		recorder := unlock.NewRecordTransport(client.Transport)
+		client.Transport = recorder
+		defer func() {
+			if err := recorder.Save(st.config.UnlockRecordDir, name); err != nil {
+				log.Warnln("保存解锁检测记录失败: %v", err)
 			}
-		}
-		close(downloadResults)
+		}()
+	}
 
-		for i := 0; i < st.config.Concurrent; i++ {
-			if ur := <-uploadResults; ur != nil {
-				totalUploadBytes += ur.bytes
-				totalUploadTime += ur.duration
-				uploadCount++
+	// 先解析出口 IP 和地理位置
+	geo, err := unlock.LookupGeo(client, st.config.GeoProviders, st.config.GeoMode, st.debugMode)
+	if err == nil {
+		result.ExitIP = geo.IP
+		result.GeoProvider = geo.Provider
+		result.Country = geo.Country
+		result.City = geo.City
+		result.ASN = geo.ASN
+		result.Organization = geo.Organization
+	}
+
+	// 出口相同的节点直接复用已有的解锁结果，关闭 -unlock-share 时只使用缓存文件中的结果
+	if st.unlockCache != nil && result.ExitIP != "" {
+		if entry, ok := st.unlockCache.get(result.ExitIP, st.config.EnableRisk, st.config.UnlockShare); ok {
+			result.Location = entry.Location
+			result.Risk = entry.Risk
+			result.StreamUnlock = entry.StreamUnlock
+			result.UnlockShared = entry.Source
+			if entry.fromFile {
+				result.UnlockShared += " (缓存)"
 			}
+			return
 		}
-		close(uploadResults)
+	}
 
-		if downloadCount > 0 {
-			result.DownloadSize = float64(totalDownloadBytes)
-			result.DownloadTime = totalDownloadTime / time.Duration(downloadCount)
-			result.DownloadSpeed = float64(totalDownloadBytes) / result.DownloadTime.Seconds()
-		}
-		if uploadCount > 0 {
-			result.UploadSize = float64(totalUploadBytes)
-			result.UploadTime = totalUploadTime / time.Duration(uploadCount)
-			result.UploadSpeed = float64(totalUploadBytes) / result.UploadTime.Seconds()
-		}
+	// 再获取风险值
+	if geo != nil {
+		result.Location = geo.Country
+		result.Risk = st.testRisk(client, geo)
 	}
 
-	return result
+	// 流媒体检测
+	result.StreamUnlock = unlock.TestAll(client, st.config.UnlockConcurrent, st.debugMode)
+	if st.unlockCache != nil && result.ExitIP != "" && result.Location != "" {
+		st.unlockCache.put(result.ExitIP, &unlockCacheEntry{
+			Location:     result.Location,
+			Risk:         result.Risk,
+			StreamUnlock: result.StreamUnlock,
+			Source:       name,
+			EnableRisk:   st.config.EnableRisk,
+			TestedAt:     time.Now(),
+		})
+	}
 }
 
-func (st *SpeedTester) testLocation(client *http.Client) (string, error) {
-	if st.config.EnableUnlock && st.config.EnableRisk {
-		return unlock.GetLocationWithRisk(client, st.debugMode, st.config.EnableRisk)
+func (st *SpeedTester) testRisk(client *http.Client, geo *unlock.GeoInfo) *unlock.RiskInfo {
+	if !st.config.EnableRisk || geo.IP == "" {
+		return nil
+	}
+	risk, err := unlock.CheckRisk(client, st.config.RiskProviders, geo.IP, st.debugMode)
+	if err != nil {
+		return nil
 	}
-	return unlock.GetLocation(client, st.debugMode)
+	return risk
 }
 
 type latencyResult struct {
 	avgLatency time.Duration
 	jitter     time.Duration
 	packetLoss float64
+	dial       time.Duration
+	tls        time.Duration
+	ttfb       time.Duration
+	cold       time.Duration // 第一次请求的延迟，包含建立代理连接的开销
+	min        time.Duration
+	median     time.Duration
+	p90        time.Duration
+	p99        time.Duration
+	max        time.Duration
 }
 
 func (st *SpeedTester) testLatency(proxy constant.Proxy) *latencyResult {
-	client := st.createClient(proxy)
-	latencies := make([]time.Duration, 0, 6)
+	client := st.createSpeedClient(proxy)
+	latencies := make([]time.Duration, 0, st.config.PingCount)
 	failedPings := 0
+	var cold time.Duration
+	var breakdown latencyBreakdown
 
-	for i := 0; i < 6; i++ {
-		time.Sleep(100 * time.Millisecond)
+	for i := 0; i < st.config.PingCount; i++ {
+		time.Sleep(st.config.PingInterval)
 
+		ctx, trace := withPingTrace(context.Background())
+		req, err := st.config.Backend.LatencyRequest(ctx)
+		if err != nil {
+			failedPings++
+			continue
+		}
 		start := time.Now()
-		resp, err := client.Get(fmt.Sprintf("%s/__down?bytes=0", st.config.ServerURL))
+		resp, err := client.Do(req)
 		if err != nil {
 			failedPings++
 			continue
 		}
 		resp.Body.Close()
-		if resp.StatusCode == http.StatusOK {
-			latencies = append(latencies, time.Since(start))
+		if isSuccessStatus(resp.StatusCode) {
+			if i == 0 {
+				cold = time.Since(start)
+			} else {
+				latencies = append(latencies, time.Since(start))
+			}
+			breakdown.add(trace)
 		} else {
 			failedPings++
 		}
 	}
 
-	return calculateLatencyStats(latencies, failedPings)
+	result := calculateLatencyStats(cold, latencies, failedPings, st.config.PingCount)
+	result.dial = averageDuration(breakdown.dial, breakdown.dialN)
+	result.tls = averageDuration(breakdown.tls, breakdown.tlsN)
+	result.ttfb = averageDuration(breakdown.ttfb, breakdown.ttfbN)
+	return result
 }
 
-type downloadResult struct {
-	bytes    int64
-	duration time.Duration
+// streamCounter 记录单个连接传输的字节数，同时计入所有连接共享的计量器，
+// 所有连接的总字节数达到 limit 时调用 stop 结束测速
+type streamCounter struct {
+	meter *throughputMeter
+	bytes int64
+	limit int64
+	stop  func()
 }
 
-func (st *SpeedTester) testDownload(proxy constant.Proxy, size int) *downloadResult {
-	client := st.createClient(proxy)
-	start := time.Now()
+func (c *streamCounter) Add(n int64) {
+	c.bytes += n
+	c.meter.Add(n)
+	if c.exhausted() {
+		c.stop()
+	}
+}
+
+func (c *streamCounter) exhausted() bool {
+	return c.limit > 0 && c.meter.Bytes() >= c.limit
+}
 
-	resp, err := client.Get(fmt.Sprintf("%s/__down?bytes=%d", st.config.ServerURL, size))
+func (st *SpeedTester) testDownload(ctx context.Context, client *http.Client, size int, counter *streamCounter) error {
+	req, err := st.config.Backend.DownloadRequest(ctx, size)
 	if err != nil {
-		return nil
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return nil
+	if !isSuccessStatus(resp.StatusCode) {
+		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
 	}
 
-	downloadBytes, _ := io.Copy(io.Discard, resp.Body)
-
-	return &downloadResult{
-		bytes:    downloadBytes,
-		duration: time.Since(start),
+	// 后端返回的数据可能多于请求的大小，只读取 size 字节
+	received, err := io.Copy(io.Discard, io.LimitReader(&meterReader{reader: resp.Body, counter: counter}, int64(size)))
+	if err != nil || !st.serverAccounting() {
+		return err
+	}
+	// download-server 正好发送 size 字节，读到 EOF 后 trailer 中才有服务端发送的字节数
+	if _, err := io.Copy(io.Discard, resp.Body); err != nil {
+		return err
 	}
+	return st.checkServerBytes(resp.Trailer, BytesSentHeader, received)
 }
 
-func (st *SpeedTester) testUpload(proxy constant.Proxy, size int) *downloadResult {
-	client := st.createClient(proxy)
-	reader := NewZeroReader(size)
-
-	start := time.Now()
-	resp, err := client.Post(
-		fmt.Sprintf("%s/__up", st.config.ServerURL),
-		"application/octet-stream",
-		reader,
-	)
+func (st *SpeedTester) testUpload(ctx context.Context, client *http.Client, size int, counter *streamCounter) error {
+	// 使用随机数据避免被代理或传输层压缩，种子随请求发送给服务器用于校验
+	seed := rand.Uint64()
+	reader := &meterReader{reader: NewRandomReader(seed, size), counter: counter}
+	req, err := st.config.Backend.UploadRequest(ctx, reader, size)
 	if err != nil {
-		return nil
+		return err
+	}
+	req.Header.Set(PayloadSeedHeader, strconv.FormatUint(seed, 10))
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
+	if !isSuccessStatus(resp.StatusCode) {
+		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+	if !st.serverAccounting() {
 		return nil
 	}
+	return st.checkServerBytes(resp.Header, BytesReceivedHeader, int64(size))
+}
+
+// isSuccessStatus 判断是否为 2xx 响应，url 后端的 Range 请求会返回 206
+func isSuccessStatus(code int) bool {
+	return code >= 200 && code < 300
+}
 
-	return &downloadResult{
-		bytes:    reader.WrittenBytes(),
-		duration: time.Since(start),
+// createSpeedClient 创建访问测速服务器的客户端，可跳过自签名证书的校验
+func (st *SpeedTester) createSpeedClient(proxy constant.Proxy) *http.Client {
+	client := st.createClient(proxy)
+	if st.config.ServerInsecure {
+		client.Transport.(*http.Transport).TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
 	}
+	return client
 }
 
 func (st *SpeedTester) createClient(proxy constant.Proxy) *http.Client {
@@ -579,11 +962,18 @@ func (st *SpeedTester) createClient(proxy constant.Proxy) *http.Client {
 	}
 }
 
-func calculateLatencyStats(latencies []time.Duration, failedPings int) *latencyResult {
+// calculateLatencyStats 计算延迟统计，第一次请求(冷启动)单独记录，其余统计只使用后续请求；
+// 只有第一次请求成功时使用它作为唯一样本
+func calculateLatencyStats(cold time.Duration, warm []time.Duration, failedPings int, pings int) *latencyResult {
 	result := &latencyResult{
-		packetLoss: float64(failedPings) / 6.0 * 100,
+		packetLoss: float64(failedPings) / float64(pings) * 100,
+		cold:       cold,
 	}
 
+	latencies := warm
+	if len(latencies) == 0 && cold > 0 {
+		latencies = []time.Duration{cold}
+	}
 	if len(latencies) == 0 {
 		return result
 	}
@@ -595,19 +985,17 @@ func calculateLatencyStats(latencies []time.Duration, failedPings int) *latencyR
 	}
 	result.avgLatency = total / time.Duration(len(latencies))
 
+	// 计算分位数
+	sorted := append([]time.Duration(nil), latencies...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	result.min = sorted[0]
+	result.median = percentile(sorted, 50)
+	result.p90 = percentile(sorted, 90)
+	result.p99 = percentile(sorted, 99)
+	result.max = sorted[len(sorted)-1]
+
 	// 计算抖动
-	var variance float64
-	for _, l := range latencies {
-		diff := float64(l - result.avgLatency)
-		variance += diff * diff
-	}
-	variance /= float64(len(latencies))
-	result.jitter = time.Duration(math.Sqrt(variance))
+	result.jitter = interarrivalJitter(latencies)
 
 	return result
 }
-
-func (st *SpeedTester) testStreamUnlock(proxy *CProxy) (string, error) {
-	client := st.createClient(proxy)
-	return unlock.TestAll(client, st.config.UnlockConcurrent, st.debugMode), nil
-}
@@ -0,0 +1,123 @@
+package speedtester
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Target 表示一个额外的测速目标服务器，例如部署在不同地区的 download-server
+type Target struct {
+	Name    string
+	Backend SpeedBackend
+}
+
+// TargetResult 表示节点到某个目标服务器的测试结果
+type TargetResult struct {
+	Name          string        `json:"name"`
+	Latency       time.Duration `json:"latency"`
+	PacketLoss    float64       `json:"packet_loss"`
+	DownloadSpeed float64       `json:"download_speed"`
+	UploadSpeed   float64       `json:"upload_speed"`
+}
+
+// ParseTargets 解析逗号分隔的 name=url 列表，所有目标使用同一种测速后端和访问令牌
+func ParseTargets(value string, backendName string, token string) ([]Target, error) {
+	var targets []Target
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		name, serverURL, ok := strings.Cut(item, "=")
+		if !ok || name == "" {
+			return nil, fmt.Errorf("invalid target %q, expected name=url", item)
+		}
+		backend, err := NewSpeedBackend(backendName, serverURL, token)
+		if err != nil {
+			return nil, fmt.Errorf("target %s: %w", name, err)
+		}
+		targets = append(targets, Target{Name: name, Backend: backend})
+	}
+	return targets, nil
+}
+
+// withBackend 返回使用另一个测速后端的 SpeedTester 副本
+func (st *SpeedTester) withBackend(backend SpeedBackend) *SpeedTester {
+	config := *st.config
+	config.Backend = backend
+	tester := *st
+	tester.config = &config
+	return &tester
+}
+
+// testTargets 依次测试节点到每个目标服务器的延迟，测速模式下同时测试下载和上传速度
+func (st *SpeedTester) testTargets(proxy *CProxy, result *Result) {
+	for _, target := range st.config.Targets {
+		tester := st.withBackend(target.Backend)
+		targetResult := TargetResult{Name: target.Name}
+
+		latency := tester.testLatency(proxy)
+		targetResult.Latency = latency.avgLatency
+		targetResult.PacketLoss = latency.packetLoss
+
+		if st.speedEnabled() && latency.avgLatency > 0 {
+			// 目标服务器的测速流量同样计入节点流量上限
+			speed := &Result{TrafficBytes: result.TrafficBytes}
+			if st.config.TestDuration > 0 {
+				tester.testSpeedDuration(proxy, speed)
+			} else {
+				tester.testSpeedFixed(proxy, speed)
+			}
+			targetResult.DownloadSpeed = speed.DownloadSpeed
+			targetResult.UploadSpeed = speed.UploadSpeed
+			result.TrafficBytes = speed.TrafficBytes
+			result.TrafficCapped = result.TrafficCapped || speed.TrafficCapped
+		}
+
+		if st.debugMode {
+			fmt.Printf("节点 %s 到 %s: %+v\n", result.ProxyName, target.Name, targetResult)
+		}
+		result.Targets = append(result.Targets, targetResult)
+	}
+}
+
+// TargetColumns 返回每个目标服务器的结果列，测速模式下包含下载和上传速度
+func TargetColumns(targets []Target, withSpeed bool) []Column {
+	var columns []Column
+	for i, target := range targets {
+		columns = append(columns, Column{
+			Name:   target.Name,
+			Header: target.Name + " 延迟",
+			Value: func(r *Result) string {
+				if i >= len(r.Targets) {
+					return "N/A"
+				}
+				return formatLatency(r.Targets[i].Latency)
+			},
+		})
+		if !withSpeed {
+			continue
+		}
+		columns = append(columns, Column{
+			Name:   target.Name,
+			Header: target.Name + " 下载",
+			Value: func(r *Result) string {
+				if i >= len(r.Targets) || r.Targets[i].Latency == 0 {
+					return "N/A"
+				}
+				return formatSpeed(r.Targets[i].DownloadSpeed)
+			},
+		}, Column{
+			Name:   target.Name,
+			Header: target.Name + " 上传",
+			Value: func(r *Result) string {
+				if i >= len(r.Targets) || r.Targets[i].Latency == 0 {
+					return "N/A"
+				}
+				return formatSpeed(r.Targets[i].UploadSpeed)
+			},
+		})
+	}
+	return columns
+}
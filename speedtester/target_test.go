@@ -0,0 +1,56 @@
+package speedtester
+
+import (
+	"context"
+	"testing"
+)
+
+func TestParseTargets(t *testing.T) {
+	targets, err := ParseTargets(" tokyo=http://1.2.3.4:8080/ ,, frankfurt=http://5.6.7.8:8080", BackendDownloadServer, "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []struct {
+		name     string
+		download string
+	}{
+		{name: "tokyo", download: "http://1.2.3.4:8080/__down?bytes=10"},
+		{name: "frankfurt", download: "http://5.6.7.8:8080/__down?bytes=10"},
+	}
+	if len(targets) != len(want) {
+		t.Fatalf("got %d targets, want %d", len(targets), len(want))
+	}
+	for i, target := range targets {
+		if target.Name != want[i].name || target.Backend.Name() != BackendDownloadServer {
+			t.Errorf("target %d = %s (%s), want %s", i, target.Name, target.Backend.Name(), want[i].name)
+		}
+		req, err := target.Backend.DownloadRequest(context.Background(), 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if req.URL.String() != want[i].download || req.Header.Get("Authorization") != "Bearer secret" {
+			t.Errorf("target %d request %s (%q)", i, req.URL, req.Header.Get("Authorization"))
+		}
+	}
+
+	if targets, err := ParseTargets("", BackendCloudflare, ""); err != nil || len(targets) != 0 {
+		t.Errorf("empty targets = %v, %v", targets, err)
+	}
+}
+
+func TestParseTargetsErrors(t *testing.T) {
+	tests := []struct {
+		value   string
+		backend string
+	}{
+		{value: "http://1.2.3.4:8080", backend: BackendDownloadServer},
+		{value: "=http://1.2.3.4:8080", backend: BackendDownloadServer},
+		{value: "tokyo=", backend: BackendDownloadServer},
+		{value: "tokyo=http://1.2.3.4:8080", backend: "unknown"},
+	}
+	for _, tt := range tests {
+		if _, err := ParseTargets(tt.value, tt.backend, ""); err == nil {
+			t.Errorf("ParseTargets(%q, %q) should fail", tt.value, tt.backend)
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package speedtester
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// errTrafficLimit 达到流量上限时中断读取的错误
+var errTrafficLimit = errors.New("traffic limit reached")
+
+// trafficBudget 记录整个测试过程中测速消耗的流量
+type trafficBudget struct {
+	limit int64 // 总流量预算，0 表示不限制
+	used  atomic.Int64
+}
+
+// ParseSize 解析 5GB、500MB、1.5G、2MiB、1024 形式的数据大小，不区分大小写，数字和单位之间可以有空格，
+// 单位按 1024 换算，空字符串返回 0
+func ParseSize(value string) (int64, error) {
+	value = strings.ToUpper(strings.TrimSpace(value))
+	if value == "" {
+		return 0, nil
+	}
+	number := strings.TrimSuffix(value, "B")
+	if n := len(number); n >= 2 && number[n-1] == 'I' && strings.ContainsRune("KMGT", rune(number[n-2])) {
+		number = number[:n-1]
+	}
+	unit := ""
+	if n := len(number); n > 0 && strings.ContainsRune("KMGT", rune(number[n-1])) {
+		number, unit = number[:n-1], number[n-1:]
+	}
+	size, err := strconv.ParseFloat(strings.TrimSpace(number), 64)
+	if err != nil || size < 0 || math.IsNaN(size) || math.IsInf(size, 0) {
+		return 0, fmt.Errorf("invalid size: %s", value)
+	}
+	multiplier := map[string]float64{
+		"":  1,
+		"K": 1 << 10,
+		"M": 1 << 20,
+		"G": 1 << 30,
+		"T": 1 << 40,
+	}[unit]
+	if size*multiplier >= math.MaxInt64 {
+		return 0, fmt.Errorf("size too large: %s", value)
+	}
+	return int64(size * multiplier), nil
+}
+
+// trafficLimit 返回当前节点下一个测速阶段最多可以使用的流量，0 表示不限制，
+// 总预算或节点上限已用完时返回 false
+func (st *SpeedTester) trafficLimit(result *Result) (int64, bool) {
+	var limit int64
+	if st.config.NodeTrafficCap > 0 {
+		limit = st.config.NodeTrafficCap - result.TrafficBytes
+		if limit <= 0 {
+			return 0, false
+		}
+	}
+	if st.traffic.limit > 0 {
+		remaining := st.traffic.limit - st.traffic.used.Load()
+		if remaining <= 0 {
+			return 0, false
+		}
+		if limit == 0 || remaining < limit {
+			limit = remaining
+		}
+	}
+	return limit, true
+}
+
+// splitTrafficLimit 为下载阶段分配 share 比例的流量，不限制时仍返回 0
+func splitTrafficLimit(limit int64, share float64) int64 {
+	if limit <= 0 {
+		return 0
+	}
+	if split := int64(float64(limit) * share); split > 0 {
+		return split
+	}
+	return 1
+}
+
+// addTraffic 将测速阶段消耗的流量计入节点和总流量
+func (st *SpeedTester) addTraffic(result *Result, run *speedRun) {
+	bytes := run.meter.Bytes()
+	result.TrafficBytes += bytes
+	st.traffic.used.Add(bytes)
+	if run.capped {
+		result.TrafficCapped = true
+	}
+}
+
+// TrafficUsed 返回测速消耗的总流量
+func (st *SpeedTester) TrafficUsed() int64 {
+	return st.traffic.used.Load()
+}
+
+// FormatTraffic 返回节点测速消耗的流量
+func (r *Result) FormatTraffic() string {
+	if r.TrafficSkipped {
+		return "预算用完"
+	}
+	traffic := formatBytes(r.TrafficBytes)
+	if r.TrafficCapped {
+		traffic += " (已达上限)"
+	}
+	return traffic
+}
+
+// FormatBytes 格式化字节数，例如 1.50GB
+func FormatBytes(bytes int64) string {
+	return formatBytes(bytes)
+}
+
+// TrafficColumn 显示节点测速消耗流量的列
+var TrafficColumn = Column{Name: "traffic", Header: "流量", Value: func(r *Result) string { return r.FormatTraffic() }}
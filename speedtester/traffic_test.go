@@ -0,0 +1,98 @@
+package speedtester
+
+import "testing"
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    int64
+		wantErr bool
+	}{
+		{value: "", want: 0},
+		{value: "1024", want: 1024},
+		{value: "1024B", want: 1024},
+		{value: "1KB", want: 1 << 10},
+		{value: "1k", want: 1 << 10},
+		{value: "500MB", want: 500 << 20},
+		{value: "500mb", want: 500 << 20},
+		{value: "2MiB", want: 2 << 20},
+		{value: "2mib", want: 2 << 20},
+		{value: "1.5G", want: 3 << 29},
+		{value: "5GB", want: 5 << 30},
+		{value: " 5 GB ", want: 5 << 30},
+		{value: "1TB", want: 1 << 40},
+		{value: "0", want: 0},
+		{value: "B", wantErr: true},
+		{value: "GB", wantErr: true},
+		{value: "-1GB", wantErr: true},
+		{value: "5PB", wantErr: true},
+		{value: "5 G B", wantErr: true},
+		{value: "1iB", wantErr: true},
+		{value: "abc", wantErr: true},
+		{value: "inf", wantErr: true},
+		{value: "NaN", wantErr: true},
+		{value: "9000000000T", wantErr: true},
+		{value: "8388608T", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseSize(tt.value)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseSize(%q) err = %v, wantErr %v", tt.value, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseSize(%q) = %d, want %d", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestSplitTrafficLimit(t *testing.T) {
+	tests := []struct {
+		limit int64
+		share float64
+		want  int64
+	}{
+		{limit: 0, share: 0.5, want: 0},
+		{limit: -1, share: 0.5, want: 0},
+		{limit: 100, share: 0.5, want: 50},
+		{limit: 3, share: 0.5, want: 1},
+		// 有限制时至少分配 1 字节，避免变成不限制
+		{limit: 1, share: 0.5, want: 1},
+		{limit: 100, share: 1, want: 100},
+	}
+	for _, tt := range tests {
+		if got := splitTrafficLimit(tt.limit, tt.share); got != tt.want {
+			t.Errorf("splitTrafficLimit(%d, %v) = %d, want %d", tt.limit, tt.share, got, tt.want)
+		}
+	}
+}
+
+func TestTrafficLimit(t *testing.T) {
+	tests := []struct {
+		name     string
+		budget   int64
+		used     int64
+		nodeCap  int64
+		nodeUsed int64
+		want     int64
+		wantOK   bool
+	}{
+		{name: "unlimited", want: 0, wantOK: true},
+		{name: "node cap", nodeCap: 100, nodeUsed: 30, want: 70, wantOK: true},
+		{name: "node cap used up", nodeCap: 100, nodeUsed: 100, wantOK: false},
+		{name: "budget", budget: 1000, used: 400, want: 600, wantOK: true},
+		{name: "budget used up", budget: 1000, used: 1000, wantOK: false},
+		{name: "budget smaller than cap", budget: 1000, used: 950, nodeCap: 100, want: 50, wantOK: true},
+		{name: "cap smaller than budget", budget: 1000, used: 100, nodeCap: 100, nodeUsed: 20, want: 80, wantOK: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			st := &SpeedTester{config: &Config{NodeTrafficCap: tt.nodeCap}, traffic: &trafficBudget{limit: tt.budget}}
+			st.traffic.used.Store(tt.used)
+			got, ok := st.trafficLimit(&Result{TrafficBytes: tt.nodeUsed})
+			if ok != tt.wantOK || (ok && got != tt.want) {
+				t.Errorf("trafficLimit() = %d, %v; want %d, %v", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
@@ -0,0 +1,179 @@
+package speedtester
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"math/rand"
+	"net"
+	"net/netip"
+	"strings"
+	"time"
+
+	"github.com/metacubex/mihomo/constant"
+)
+
+const (
+	// udpProbeCount 每个节点发送的 UDP 探测次数，在各个目标之间轮流发送
+	udpProbeCount = 6
+	// udpQueryDomain DNS 探测查询的域名
+	udpQueryDomain = "www.cloudflare.com"
+)
+
+// udpDNSServers 用于 UDP 探测的公共 DNS 服务器，使用 IP 避免依赖远端解析
+var udpDNSServers = []string{"1.1.1.1:53", "8.8.8.8:53"}
+
+// UDPResult 表示通过节点进行 UDP 探测的结果
+type UDPResult struct {
+	Supported  bool          `json:"supported"`   // 节点声明支持 UDP
+	Latency    time.Duration `json:"latency"`     // 成功探测的平均往返时间
+	PacketLoss float64       `json:"packet_loss"` // 丢包率
+	Probes     int           `json:"probes"`      // 实际发送的探测次数
+}
+
+// Format 格式化为 35ms (丢包 20.0%) 形式
+func (r *UDPResult) Format() string {
+	switch {
+	case !r.Supported:
+		return "不支持"
+	case r.Latency == 0:
+		return "失败"
+	case r.PacketLoss > 0:
+		return fmt.Sprintf("%dms (丢包 %.1f%%)", r.Latency.Milliseconds(), r.PacketLoss)
+	default:
+		return fmt.Sprintf("%dms", r.Latency.Milliseconds())
+	}
+}
+
+// udpTarget 表示一个 UDP 探测目标，build 生成请求，match 判断响应是否属于该请求
+type udpTarget struct {
+	addr  *net.UDPAddr
+	build func() (request []byte, match func(response []byte) bool)
+}
+
+// testUDP 通过节点的 ListenPacketContext 向 DNS 服务器和可选的 UDP echo 服务器发送探测
+func (st *SpeedTester) testUDP(proxy constant.Proxy) *UDPResult {
+	result := &UDPResult{Supported: proxy.SupportUDP()}
+	if !result.Supported {
+		return result
+	}
+
+	targets, err := st.udpTargets()
+	if err != nil {
+		if st.debugMode {
+			fmt.Printf("UDP 探测目标无效: %v\n", err)
+		}
+		result.PacketLoss = 100
+		return result
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), st.config.Timeout)
+	defer cancel()
+	addr, _ := netip.AddrFromSlice(targets[0].addr.IP)
+	conn, err := proxy.ListenPacketContext(ctx, &constant.Metadata{
+		NetWork: constant.UDP,
+		DstIP:   addr.Unmap(),
+		DstPort: uint16(targets[0].addr.Port),
+	})
+	if err != nil {
+		if st.debugMode {
+			fmt.Printf("UDP 连接 %s 失败: %v\n", proxy.Name(), err)
+		}
+		result.PacketLoss = 100
+		return result
+	}
+	defer conn.Close()
+
+	var total time.Duration
+	var received int
+	buf := make([]byte, 2048)
+	for i := 0; i < udpProbeCount; i++ {
+		// 第一轮所有目标都没有响应时，认为节点 UDP 不可用，不再继续等待
+		if i == len(targets) && received == 0 {
+			break
+		}
+		target := targets[i%len(targets)]
+		request, match := target.build()
+
+		result.Probes++
+		start := time.Now()
+		if _, err := conn.WriteTo(request, target.addr); err != nil {
+			if st.debugMode {
+				fmt.Printf("UDP 发送到 %s 失败: %v\n", target.addr, err)
+			}
+			continue
+		}
+		conn.SetReadDeadline(start.Add(st.config.Timeout))
+		for {
+			n, _, err := conn.ReadFrom(buf)
+			if err != nil {
+				if st.debugMode {
+					fmt.Printf("UDP 等待 %s 响应失败: %v\n", target.addr, err)
+				}
+				break
+			}
+			// 忽略之前超时请求的迟到响应
+			if match(buf[:n]) {
+				total += time.Since(start)
+				received++
+				break
+			}
+		}
+	}
+
+	result.PacketLoss = float64(result.Probes-received) / float64(result.Probes) * 100
+	if received > 0 {
+		result.Latency = total / time.Duration(received)
+	}
+	return result
+}
+
+// udpTargets 返回 DNS 探测目标，配置了 UDP echo 服务器时一并加入
+func (st *SpeedTester) udpTargets() ([]udpTarget, error) {
+	var targets []udpTarget
+	for _, server := range udpDNSServers {
+		addr, err := net.ResolveUDPAddr("udp", server)
+		if err != nil {
+			return nil, err
+		}
+		targets = append(targets, udpTarget{addr: addr, build: buildDNSProbe})
+	}
+	if st.config.UDPEchoServer != "" {
+		addr, err := net.ResolveUDPAddr("udp", st.config.UDPEchoServer)
+		if err != nil {
+			return nil, fmt.Errorf("resolve udp echo server %s: %w", st.config.UDPEchoServer, err)
+		}
+		targets = append(targets, udpTarget{addr: addr, build: buildEchoProbe})
+	}
+	return targets, nil
+}
+
+// buildDNSProbe 构造一个随机 ID 的 A 记录查询，响应的 ID 一致且 QR 位为 1 时匹配
+func buildDNSProbe() ([]byte, func([]byte) bool) {
+	id := uint16(rand.Intn(1 << 16))
+	query := make([]byte, 12, 64)
+	binary.BigEndian.PutUint16(query[0:], id)
+	binary.BigEndian.PutUint16(query[2:], 0x0100) // 期望递归
+	binary.BigEndian.PutUint16(query[4:], 1)      // 1 个问题
+	for _, label := range strings.Split(udpQueryDomain, ".") {
+		query = append(query, byte(len(label)))
+		query = append(query, label...)
+	}
+	query = append(query, 0, 0, 1, 0, 1) // 根标签，类型 A，类 IN
+
+	return query, func(response []byte) bool {
+		return len(response) >= 12 &&
+			binary.BigEndian.Uint16(response[0:]) == id &&
+			response[2]&0x80 != 0
+	}
+}
+
+// buildEchoProbe 构造随机内容的 echo 请求，响应内容完全一致时匹配
+func buildEchoProbe() ([]byte, func([]byte) bool) {
+	payload := make([]byte, 32)
+	rand.Read(payload)
+	return payload, func(response []byte) bool {
+		return bytes.Equal(response, payload)
+	}
+}
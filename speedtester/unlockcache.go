@@ -0,0 +1,100 @@
+package speedtester
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/faceair/clash-speedtest/unlock"
+)
+
+// unlockCacheEntry 记录某个出口 IP 的解锁检测结果
+type unlockCacheEntry struct {
+	Location     string           `json:"location"`
+	Risk         *unlock.RiskInfo `json:"risk"`
+	StreamUnlock string           `json:"stream_unlock"`
+	Source       string           `json:"source"`
+	EnableRisk   bool             `json:"enable_risk"`
+	TestedAt     time.Time        `json:"tested_at"`
+	fromFile     bool
+}
+
+// unlockCache 按出口 IP 缓存解锁检测结果，相同出口的节点复用同一份结果
+type unlockCache struct {
+	mutex   sync.Mutex
+	path    string
+	ttl     time.Duration
+	entries map[string]*unlockCacheEntry
+}
+
+// newUnlockCache 创建缓存，path 不为空时从文件加载未过期的记录
+func newUnlockCache(path string, ttl time.Duration) (*unlockCache, error) {
+	cache := &unlockCache{
+		path:    path,
+		ttl:     ttl,
+		entries: make(map[string]*unlockCacheEntry),
+	}
+	if path == "" {
+		return cache, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return cache, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &cache.entries); err != nil {
+		return nil, err
+	}
+	for ip, entry := range cache.entries {
+		if cache.expired(entry) {
+			delete(cache.entries, ip)
+			continue
+		}
+		entry.fromFile = true
+	}
+	return cache, nil
+}
+
+func (c *unlockCache) expired(entry *unlockCacheEntry) bool {
+	return c.ttl > 0 && time.Since(entry.TestedAt) > c.ttl
+}
+
+// get 返回出口 IP 对应的缓存结果，风险检测开关不一致时视为未命中；
+// share 为 false 时只返回从文件加载的结果，不复用本次运行中其他节点的检测结果
+func (c *unlockCache) get(ip string, enableRisk, share bool) (*unlockCacheEntry, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	entry, ok := c.entries[ip]
+	if !ok || entry.EnableRisk != enableRisk || c.expired(entry) || (!share && !entry.fromFile) {
+		return nil, false
+	}
+	return entry, true
+}
+
+func (c *unlockCache) put(ip string, entry *unlockCacheEntry) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.entries[ip] = entry
+}
+
+// save 将缓存写回文件，未指定文件时不做任何事
+func (c *unlockCache) save() error {
+	if c.path == "" {
+		return nil
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	data, err := json.MarshalIndent(c.entries, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(c.path, data, 0o644)
+}
@@ -0,0 +1,262 @@
+package unlock
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+const (
+	// GeoModeFallback 按顺序尝试地理位置服务，使用第一个成功的结果
+	GeoModeFallback = "fallback"
+	// GeoModeConsensus 同时查询所有地理位置服务，取多数一致的国家
+	GeoModeConsensus = "consensus"
+)
+
+// DefaultGeoProviders 默认使用的地理位置服务及顺序
+const DefaultGeoProviders = "ipcheck,ipinfo,ipapi,cloudflare,ipsb"
+
+// GeoInfo 表示出口 IP 的地理位置信息
+type GeoInfo struct {
+	IP           string `json:"ip"`
+	Country      string `json:"country"`
+	City         string `json:"city,omitempty"`
+	ASN          uint   `json:"asn,omitempty"`
+	Organization string `json:"organization,omitempty"`
+	Provider     string `json:"provider"`
+}
+
+// GeoProvider 定义地理位置服务
+type GeoProvider interface {
+	Name() string
+	Lookup(client *http.Client, debugMode bool) (*GeoInfo, error)
+}
+
+var geoProviderFactories = map[string]func() GeoProvider{
+	"ipcheck":    func() GeoProvider { return ipcheckGeoProvider{} },
+	"ipinfo":     func() GeoProvider { return ipinfoGeoProvider{} },
+	"ipapi":      func() GeoProvider { return ipapiGeoProvider{} },
+	"cloudflare": func() GeoProvider { return cloudflareGeoProvider{} },
+	"ipsb":       func() GeoProvider { return ipsbGeoProvider{} },
+}
+
+// ParseGeoProviders 解析逗号分隔的地理位置服务名称列表
+func ParseGeoProviders(names string) ([]GeoProvider, error) {
+	var providers []GeoProvider
+	for _, name := range strings.Split(names, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		factory, ok := geoProviderFactories[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown geo provider: %s", name)
+		}
+		providers = append(providers, factory())
+	}
+	if len(providers) == 0 {
+		return nil, fmt.Errorf("no geo provider specified")
+	}
+	return providers, nil
+}
+
+// LookupGeo 使用给定的地理位置服务查询出口 IP 和国家
+func LookupGeo(client *http.Client, providers []GeoProvider, mode string, debugMode bool) (*GeoInfo, error) {
+	if len(providers) == 0 {
+		providers, _ = ParseGeoProviders(DefaultGeoProviders)
+	}
+	if mode == GeoModeConsensus {
+		return lookupGeoConsensus(client, providers, debugMode)
+	}
+
+	var lastErr error
+	for _, provider := range providers {
+		info, err := lookupGeoProvider(client, provider, debugMode)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		return info, nil
+	}
+	return nil, fmt.Errorf("all geo providers failed: %v", lastErr)
+}
+
+func lookupGeoProvider(client *http.Client, provider GeoProvider, debugMode bool) (*GeoInfo, error) {
+	info, err := provider.Lookup(client, debugMode)
+	if err == nil && info.Country == "" {
+		err = fmt.Errorf("no country information in response")
+	}
+	if err != nil {
+		if debugMode {
+			fmt.Printf("地理位置服务 %s 查询失败: %v\n", provider.Name(), err)
+		}
+		return nil, err
+	}
+	info.Country = strings.ToUpper(info.Country)
+	info.Provider = provider.Name()
+	if debugMode {
+		fmt.Printf("地理位置服务 %s: IP %s, 国家 %s\n", provider.Name(), info.IP, info.Country)
+	}
+	return info, nil
+}
+
+// lookupGeoConsensus 并发查询所有服务，返回多数一致的国家，票数相同时按服务顺序优先
+func lookupGeoConsensus(client *http.Client, providers []GeoProvider, debugMode bool) (*GeoInfo, error) {
+	infos := make([]*GeoInfo, len(providers))
+	var wg sync.WaitGroup
+	for i, provider := range providers {
+		wg.Add(1)
+		go func(i int, provider GeoProvider) {
+			defer wg.Done()
+			infos[i], _ = lookupGeoProvider(client, provider, debugMode)
+		}(i, provider)
+	}
+	wg.Wait()
+
+	votes := make(map[string][]*GeoInfo)
+	var best string
+	for _, info := range infos {
+		if info == nil {
+			continue
+		}
+		votes[info.Country] = append(votes[info.Country], info)
+		if best == "" || len(votes[info.Country]) > len(votes[best]) {
+			best = info.Country
+		}
+	}
+	if best == "" {
+		return nil, fmt.Errorf("all geo providers failed")
+	}
+
+	names := make([]string, 0, len(votes[best]))
+	for _, info := range votes[best] {
+		names = append(names, info.Provider)
+	}
+	info := *votes[best][0]
+	info.Provider = strings.Join(names, "+")
+	return &info, nil
+}
+
+// getGeoBody 使用随机请求头请求地理位置接口并返回解压后的响应体
+func getGeoBody(client *http.Client, url string, debugMode bool) ([]byte, error) {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header = generateRandomHeaders(rand.Float32() < 0.3)
+
+	resp, err := doRequestWithRetry(client, req, 2, debugMode)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+	return readCompressedBody(resp)
+}
+
+type ipcheckGeoProvider struct{}
+
+func (ipcheckGeoProvider) Name() string { return "ipcheck" }
+
+func (ipcheckGeoProvider) Lookup(client *http.Client, debugMode bool) (*GeoInfo, error) {
+	geoResp, err := fetchGeo(client, debugMode)
+	if err != nil {
+		return nil, err
+	}
+	return &GeoInfo{IP: geoResp.IP, Country: geoResp.Country}, nil
+}
+
+type ipinfoGeoProvider struct{}
+
+func (ipinfoGeoProvider) Name() string { return "ipinfo" }
+
+func (ipinfoGeoProvider) Lookup(client *http.Client, debugMode bool) (*GeoInfo, error) {
+	body, err := getGeoBody(client, "https://ipinfo.io/json", debugMode)
+	if err != nil {
+		return nil, err
+	}
+	var resp struct {
+		IP      string `json:"ip"`
+		Country string `json:"country"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, err
+	}
+	return &GeoInfo{IP: resp.IP, Country: resp.Country}, nil
+}
+
+type ipapiGeoProvider struct{}
+
+func (ipapiGeoProvider) Name() string { return "ipapi" }
+
+func (ipapiGeoProvider) Lookup(client *http.Client, debugMode bool) (*GeoInfo, error) {
+	body, err := getGeoBody(client, "http://ip-api.com/json/?fields=status,message,countryCode,query", debugMode)
+	if err != nil {
+		return nil, err
+	}
+	var resp struct {
+		Status      string `json:"status"`
+		Message     string `json:"message"`
+		CountryCode string `json:"countryCode"`
+		Query       string `json:"query"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, err
+	}
+	if resp.Status != "success" {
+		return nil, fmt.Errorf("ip-api: %s", resp.Message)
+	}
+	return &GeoInfo{IP: resp.Query, Country: resp.CountryCode}, nil
+}
+
+type cloudflareGeoProvider struct{}
+
+func (cloudflareGeoProvider) Name() string { return "cloudflare" }
+
+func (cloudflareGeoProvider) Lookup(client *http.Client, debugMode bool) (*GeoInfo, error) {
+	body, err := getGeoBody(client, "https://www.cloudflare.com/cdn-cgi/trace", debugMode)
+	if err != nil {
+		return nil, err
+	}
+	trace := ParseTrace(body)
+	return &GeoInfo{IP: trace["ip"], Country: trace["loc"]}, nil
+}
+
+// ParseTrace 解析 Cloudflare /cdn-cgi/trace 返回的 key=value 文本
+func ParseTrace(body []byte) map[string]string {
+	fields := make(map[string]string)
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	for scanner.Scan() {
+		if key, value, ok := strings.Cut(scanner.Text(), "="); ok {
+			fields[key] = value
+		}
+	}
+	return fields
+}
+
+type ipsbGeoProvider struct{}
+
+func (ipsbGeoProvider) Name() string { return "ipsb" }
+
+func (ipsbGeoProvider) Lookup(client *http.Client, debugMode bool) (*GeoInfo, error) {
+	body, err := getGeoBody(client, "https://api.ip.sb/geoip", debugMode)
+	if err != nil {
+		return nil, err
+	}
+	var resp struct {
+		IP          string `json:"ip"`
+		CountryCode string `json:"country_code"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, err
+	}
+	return &GeoInfo{IP: resp.IP, Country: resp.CountryCode}, nil
+}
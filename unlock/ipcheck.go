@@ -171,28 +171,11 @@ const (
 	colorReset  = "\033[0m"
 )
 
-type IPRiskResponse struct {
-	Risk interface{} `json:"risk"`
-}
-
 type GeoResponse struct {
 	Country string `json:"country"`
 	IP      string `json:"ip"`
 }
 
-// geoResult 用于在通道中传递地理位置信息
-type geoResult struct {
-	country string
-	ip      string
-	err     error
-}
-
-// riskResult 用于在通道中传递风险值信息
-type riskResult struct {
-	risk interface{}
-	err  error
-}
-
 func readCompressedBody(resp *http.Response) ([]byte, error) {
 	var reader io.ReadCloser
 	var err error
@@ -213,14 +196,14 @@ func readCompressedBody(resp *http.Response) ([]byte, error) {
 	return io.ReadAll(reader)
 }
 
-// GetLocation 获取地理位置信息
-func GetLocation(client *http.Client, debugMode bool) (string, error) {
+// fetchGeo 请求地理位置接口，返回出口 IP 和国家信息
+func fetchGeo(client *http.Client, debugMode bool) (*GeoResponse, error) {
 	req, err := http.NewRequest("GET", "https://64.ipcheck.ing/geo", nil)
 	if err != nil {
 		if debugMode {
 			fmt.Printf("创建请求失败: %v\n", err)
 		}
-		return "N/A", err
+		return nil, err
 	}
 
 	// 使用随机请求头
@@ -239,7 +222,7 @@ func GetLocation(client *http.Client, debugMode bool) (string, error) {
 		if debugMode {
 			fmt.Printf("请求失败: %v\n", err)
 		}
-		return "N/A", err
+		return nil, err
 	}
 	defer resp.Body.Close()
 
@@ -248,7 +231,7 @@ func GetLocation(client *http.Client, debugMode bool) (string, error) {
 		if debugMode {
 			fmt.Printf("读取响应失败: %v\n", err)
 		}
-		return "N/A", err
+		return nil, err
 	}
 
 	if debugMode {
@@ -263,170 +246,9 @@ func GetLocation(client *http.Client, debugMode bool) (string, error) {
 		if debugMode {
 			fmt.Printf("JSON 解析错误: %v\n", err)
 		}
-		return "N/A", err
-	}
-
-	if geoResp.Country != "" {
-		if debugMode {
-			fmt.Printf("成功获取到国家信息: %s\n", geoResp.Country)
-		}
-		return geoResp.Country, nil
-	}
-	if debugMode {
-		fmt.Println("响应中没有国家信息")
-	}
-	return "N/A", fmt.Errorf("no country information in response")
-}
-
-// GetLocationWithRisk 获取地理位置和IP纯净度信息
-func GetLocationWithRisk(client *http.Client, debugMode bool, enableRisk bool) (string, error) {
-	if debugMode {
-		fmt.Println("开始获取地理位置信息...")
-	}
-
-	// 设置总体超时
-	client.Timeout = 5 * time.Second
-
-	// 先获取地理位置
-	city, err := GetLocation(client, debugMode)
-	if err != nil || city == "N/A" {
-		if debugMode {
-			fmt.Printf("获取地理位置失败: %v\n", err)
-		}
-		return "N/A", err
-	}
-
-	// 如果不启用风险检测，直接返回地理位置
-	if !enableRisk {
-		return city, nil
-	}
-
-	// 创建一个新的客户端用于风险值请求
-	riskClient := &http.Client{
-		Timeout:   5 * time.Second,
-		Transport: client.Transport,
-	}
-
-	// 获取IP
-	req, err := http.NewRequest("GET", "https://64.ipcheck.ing/geo", nil)
-	if err != nil {
-		return city, nil // 出错时返回地理位置
-	}
-
-	// 使用随机请求头
-	isMobile := rand.Float32() < 0.3
-	req.Header = generateRandomHeaders(isMobile)
-
-	// 使用重试机制获取IP
-	resp, err := doRequestWithRetry(riskClient, req, 3, debugMode)
-	if err != nil {
-		return city, nil
+		return nil, err
 	}
-	defer resp.Body.Close()
-
-	body, err := readCompressedBody(resp)
-	if err != nil {
-		return city, nil
-	}
-
-	var geoResp struct {
-		IP string `json:"ip"`
-	}
-	if err := json.Unmarshal(body, &geoResp); err != nil {
-		return city, nil
-	}
-
-	// 获取 IP 风险值
-	riskReq, err := http.NewRequest("GET", fmt.Sprintf("https://ipcheck.ing/api/ipchecking?ip=%s&lang=zh-CN", geoResp.IP), nil)
-	if err != nil {
-		return city, nil
-	}
-
-	// 设置相同请求头
-	for key, values := range req.Header {
-		riskReq.Header[key] = values
-	}
-	// 添加必要的额外头
-	riskReq.Header.Set("Referer", "https://ipcheck.ing/")
-	riskReq.Header.Set("Origin", "https://ipcheck.ing/")
-
-	// 使用重试机制获取风险值
-	riskResp, err := doRequestWithRetry(riskClient, riskReq, 3, debugMode)
-	if err != nil {
-		return city, nil
-	}
-	defer riskResp.Body.Close()
-
-	riskBody, err := readCompressedBody(riskResp)
-	if err != nil {
-		return city, nil
-	}
-
-	if debugMode {
-		fmt.Printf("风险值响应: %s\n", string(riskBody))
-	}
-
-	var riskData struct {
-		ProxyDetect struct {
-			Proxy    string      `json:"proxy"`
-			Risk     interface{} `json:"risk"`
-			Type     string      `json:"type"`
-			Operator string      `json:"operator"`
-			Protocol string      `json:"protocol"`
-		} `json:"proxyDetect"`
-	}
-	if err := json.Unmarshal(riskBody, &riskData); err != nil {
-		if debugMode {
-			fmt.Printf("解析风险值响应失败: %v\n", err)
-		}
-		return city, nil
-	}
-
-	if debugMode {
-		fmt.Printf("解析后的风险值数据: %+v\n", riskData.ProxyDetect)
-	}
-
-	// 根据风险值返回不同结果
-	var riskLevel string
-	if debugMode {
-		fmt.Printf("风险值类型: %T, 值: %v\n", riskData.ProxyDetect.Risk, riskData.ProxyDetect.Risk)
-	}
-
-	switch v := riskData.ProxyDetect.Risk.(type) {
-	case float64:
-		if v == 0 {
-			riskLevel = fmt.Sprintf("[%.0f 纯净]", v)
-		} else if v < 66 {
-			riskLevel = fmt.Sprintf("[%.0f 一般]", v)
-		} else {
-			riskLevel = fmt.Sprintf("[%.0f 较差]", v)
-		}
-	case json.Number:
-		f, _ := v.Float64()
-		if f == 0 {
-			riskLevel = fmt.Sprintf("[%.0f 纯净]", f)
-		} else if f < 66 {
-			riskLevel = fmt.Sprintf("[%.0f 一般]", f)
-		} else {
-			riskLevel = fmt.Sprintf("[%.0f 较差]", f)
-		}
-	case nil:
-		riskLevel = fmt.Sprintf("[100 非常差]")
-	default:
-		if str, ok := v.(string); ok && str == "" {
-			riskLevel = fmt.Sprintf("[100 非常差]")
-		} else {
-			riskLevel = fmt.Sprintf("[%v 未知]", v)
-		}
-	}
-
-	// 如果有风险值，返回带风险值的结果
-	if riskData.ProxyDetect.Risk != nil {
-		return fmt.Sprintf("%s %s", city, riskLevel), nil
-	}
-
-	// 否则只返回地理位置
-	return city, nil
+	return &geoResp, nil
 }
 
 func init() {
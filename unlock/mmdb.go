@@ -0,0 +1,173 @@
+package unlock
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/oschwald/maxminddb-golang"
+)
+
+// GeoDB 使用本地 MMDB 数据库(MaxMind 或 ipinfo 格式)查询出口 IP 的地理位置和 ASN
+type GeoDB struct {
+	geoReader *maxminddb.Reader
+	asnReader *maxminddb.Reader
+}
+
+// OpenGeoDB 打开地理位置和 ASN 数据库，两个路径都可以为空
+func OpenGeoDB(geoPath, asnPath string) (*GeoDB, error) {
+	db := &GeoDB{}
+	if geoPath != "" {
+		reader, err := maxminddb.Open(geoPath)
+		if err != nil {
+			return nil, fmt.Errorf("open geoip database %s: %w", geoPath, err)
+		}
+		db.geoReader = reader
+	}
+	if asnPath != "" {
+		reader, err := maxminddb.Open(asnPath)
+		if err != nil {
+			db.Close()
+			return nil, fmt.Errorf("open asn database %s: %w", asnPath, err)
+		}
+		db.asnReader = reader
+	}
+	return db, nil
+}
+
+// Close 关闭已打开的数据库
+func (db *GeoDB) Close() error {
+	var err error
+	if db.geoReader != nil {
+		err = db.geoReader.Close()
+	}
+	if db.asnReader != nil {
+		if asnErr := db.asnReader.Close(); err == nil {
+			err = asnErr
+		}
+	}
+	return err
+}
+
+func (db *GeoDB) Name() string { return "mmdb" }
+
+// Lookup 通过 Cloudflare trace 获取出口 IP，再在本地数据库中查询地理位置
+func (db *GeoDB) Lookup(client *http.Client, debugMode bool) (*GeoInfo, error) {
+	body, err := getGeoBody(client, "https://www.cloudflare.com/cdn-cgi/trace", debugMode)
+	if err != nil {
+		return nil, err
+	}
+	trace := ParseTrace(body)
+	if trace["ip"] == "" {
+		return nil, fmt.Errorf("no ip information in response")
+	}
+	info, err := db.LookupIP(trace["ip"])
+	if err != nil {
+		return nil, err
+	}
+	// 只有 ASN 数据库时没有国家信息，使用 trace 中的 loc
+	if info.Country == "" {
+		info.Country = trace["loc"]
+	}
+	return info, nil
+}
+
+// WithASN 返回在查询结果中补充本地 ASN 数据库信息的地理位置服务，用于只指定了 ASN 数据库的情况
+func (db *GeoDB) WithASN(providers []GeoProvider) []GeoProvider {
+	wrapped := make([]GeoProvider, 0, len(providers))
+	for _, provider := range providers {
+		wrapped = append(wrapped, &asnGeoProvider{GeoProvider: provider, db: db})
+	}
+	return wrapped
+}
+
+// asnGeoProvider 使用原地理位置服务查询国家，ASN 和运营商缺失时从本地数据库补充
+type asnGeoProvider struct {
+	GeoProvider
+	db *GeoDB
+}
+
+func (p *asnGeoProvider) Lookup(client *http.Client, debugMode bool) (*GeoInfo, error) {
+	info, err := p.GeoProvider.Lookup(client, debugMode)
+	if err != nil || info.IP == "" || (info.ASN != 0 && info.Organization != "") {
+		return info, err
+	}
+	if record, err := p.db.LookupIP(info.IP); err == nil {
+		if info.ASN == 0 {
+			info.ASN = record.ASN
+		}
+		if info.Organization == "" {
+			info.Organization = record.Organization
+		}
+	}
+	return info, nil
+}
+
+// LookupIP 在本地数据库中查询指定 IP
+func (db *GeoDB) LookupIP(ip string) (*GeoInfo, error) {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return nil, fmt.Errorf("invalid ip: %s", ip)
+	}
+
+	info := &GeoInfo{IP: ip}
+	for _, reader := range []*maxminddb.Reader{db.geoReader, db.asnReader} {
+		if reader == nil {
+			continue
+		}
+		var record map[string]any
+		if err := reader.Lookup(parsed, &record); err != nil {
+			return nil, err
+		}
+		mergeMMDBRecord(info, record)
+	}
+	return info, nil
+}
+
+// mergeMMDBRecord 同时兼容 MaxMind 和 ipinfo 两种数据库的字段
+func mergeMMDBRecord(info *GeoInfo, record map[string]any) {
+	if info.Country == "" {
+		// MaxMind: country.iso_code，ipinfo: country
+		switch country := record["country"].(type) {
+		case map[string]any:
+			info.Country, _ = country["iso_code"].(string)
+		case string:
+			info.Country = country
+		}
+	}
+	if info.City == "" {
+		// MaxMind: city.names.en，ipinfo: city
+		switch city := record["city"].(type) {
+		case map[string]any:
+			if names, ok := city["names"].(map[string]any); ok {
+				info.City, _ = names["en"].(string)
+			}
+		case string:
+			info.City = city
+		}
+	}
+	if info.ASN == 0 {
+		// MaxMind: autonomous_system_number，ipinfo: asn ("AS13335")
+		switch asn := record["autonomous_system_number"].(type) {
+		case uint64:
+			info.ASN = uint(asn)
+		case uint32:
+			info.ASN = uint(asn)
+		}
+		if asn, ok := record["asn"].(string); ok {
+			if n, err := strconv.ParseUint(strings.TrimPrefix(strings.ToUpper(asn), "AS"), 10, 32); err == nil {
+				info.ASN = uint(n)
+			}
+		}
+	}
+	if info.Organization == "" {
+		for _, key := range []string{"autonomous_system_organization", "as_name", "name"} {
+			if org, ok := record[key].(string); ok && org != "" {
+				info.Organization = org
+				break
+			}
+		}
+	}
+}
@@ -63,8 +63,8 @@ func TestNetflix(client *http.Client) *StreamResult {
 	}
 
 	// 尝试获取地区信息
-	if strings.Contains(htmlContent, `"requestCountry":`) {
-		start := strings.Index(htmlContent, `"requestCountry":"`) + 17
+	if index := strings.Index(htmlContent, `"requestCountry":"`); index >= 0 {
+		start := index + len(`"requestCountry":"`)
 		end := strings.Index(htmlContent[start:], `"`) + start
 		if end > start {
 			result.Status = "Success"
@@ -0,0 +1,252 @@
+package unlock
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// fixtureFile 每个节点目录下保存 HTTP 交互记录的文件名
+const fixtureFile = "exchanges.json"
+
+// Exchange 表示一次被记录的 HTTP 请求与响应
+type Exchange struct {
+	Method     string      `json:"method"`
+	URL        string      `json:"url"`
+	StatusCode int         `json:"status_code"`
+	Header     http.Header `json:"header"`
+	Body       []byte      `json:"body"`
+	Error      string      `json:"error,omitempty"`
+}
+
+// nodeFile 每个节点目录下保存原始节点名称的文件名
+const nodeFile = "node.txt"
+
+// volatileParams 每次请求都会变化的查询参数(随机 session、时间戳等)，匹配记录时忽略
+var volatileParams = map[string]bool{
+	"session":   true,
+	"_":         true,
+	"t":         true,
+	"ts":        true,
+	"timestamp": true,
+	"nonce":     true,
+	"rand":      true,
+}
+
+// exchangeKey 返回匹配记录使用的键，忽略易变的查询参数，其余参数按名称排序
+func exchangeKey(method, rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return method + " " + rawURL
+	}
+	query := u.Query()
+	for name := range query {
+		if volatileParams[strings.ToLower(name)] {
+			query.Del(name)
+		}
+	}
+	u.RawQuery = query.Encode()
+	u.Fragment = ""
+	return method + " " + u.String()
+}
+
+// pathKey 返回只包含请求方法、域名和路径的键，查询参数不同时作为后备匹配
+func pathKey(method, rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return method + " " + rawURL
+	}
+	return method + " " + u.Scheme + "://" + u.Host + u.Path
+}
+
+// FixtureDir 返回节点对应的记录目录，节点名称中的非法字符会被替换，
+// 并加上原始名称的短哈希，避免 A/B 和 A_B 这样的名称写入同一个目录
+func FixtureDir(root, nodeName string) string {
+	name := strings.Map(func(r rune) rune {
+		switch r {
+		case '/', '\\', ':', '*', '?', '"', '<', '>', '|':
+			return '_'
+		}
+		return r
+	}, strings.TrimSpace(nodeName))
+	if name == "" || name == "." || name == ".." {
+		name = "_"
+	}
+	sum := sha256.Sum256([]byte(nodeName))
+	return filepath.Join(root, fmt.Sprintf("%s-%x", name, sum[:4]))
+}
+
+// FixtureNodeName 返回记录目录对应的原始节点名称，没有记录时返回目录名
+func FixtureNodeName(dir string) string {
+	if data, err := os.ReadFile(filepath.Join(dir, nodeFile)); err == nil && len(data) > 0 {
+		return string(data)
+	}
+	return filepath.Base(dir)
+}
+
+// RecordTransport 在转发请求的同时记录每次 HTTP 交互
+type RecordTransport struct {
+	next      http.RoundTripper
+	mutex     sync.Mutex
+	exchanges []*Exchange
+}
+
+// NewRecordTransport 创建记录用的 Transport，next 为空时使用 http.DefaultTransport
+func NewRecordTransport(next http.RoundTripper) *RecordTransport {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &RecordTransport{next: next}
+}
+
+func (t *RecordTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	exchange := &Exchange{
+		Method: req.Method,
+		URL:    req.URL.String(),
+	}
+
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		exchange.Error = err.Error()
+		t.add(exchange)
+		return nil, err
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		exchange.Error = err.Error()
+		t.add(exchange)
+		return nil, err
+	}
+
+	exchange.StatusCode = resp.StatusCode
+	exchange.Header = resp.Header.Clone()
+	exchange.Body = body
+	t.add(exchange)
+
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	return resp, nil
+}
+
+func (t *RecordTransport) add(exchange *Exchange) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.exchanges = append(t.exchanges, exchange)
+}
+
+// Save 将记录的交互和节点名称写入 root 下该节点的记录目录
+func (t *RecordTransport) Save(root, nodeName string) error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	dir := FixtureDir(root, nodeName)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("创建记录目录失败: %w", err)
+	}
+	data, err := json.MarshalIndent(t.exchanges, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(dir, nodeFile), []byte(nodeName), 0o644); err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, fixtureFile), data, 0o644)
+}
+
+// ReplayTransport 按请求方法和 URL 回放已记录的响应，不访问网络；
+// URL 中的随机 session、时间戳等参数不参与匹配，找不到时按方法、域名和路径匹配
+type ReplayTransport struct {
+	mutex     sync.Mutex
+	exchanges map[string][]*Exchange
+	paths     map[string][]*Exchange
+	served    map[string]int
+}
+
+// NewReplayTransport 从 dir 目录加载记录的交互
+func NewReplayTransport(dir string) (*ReplayTransport, error) {
+	data, err := os.ReadFile(filepath.Join(dir, fixtureFile))
+	if err != nil {
+		return nil, err
+	}
+	var exchanges []*Exchange
+	if err := json.Unmarshal(data, &exchanges); err != nil {
+		return nil, fmt.Errorf("解析记录文件失败: %w", err)
+	}
+
+	t := &ReplayTransport{
+		exchanges: make(map[string][]*Exchange),
+		paths:     make(map[string][]*Exchange),
+		served:    make(map[string]int),
+	}
+	for _, exchange := range exchanges {
+		key := exchangeKey(exchange.Method, exchange.URL)
+		t.exchanges[key] = append(t.exchanges[key], exchange)
+		path := pathKey(exchange.Method, exchange.URL)
+		t.paths[path] = append(t.paths[path], exchange)
+	}
+	return t, nil
+}
+
+func (t *ReplayTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body != nil {
+		req.Body.Close()
+	}
+	key := exchangeKey(req.Method, req.URL.String())
+
+	t.mutex.Lock()
+	recorded := t.exchanges[key]
+	if len(recorded) == 0 {
+		key = pathKey(req.Method, req.URL.String())
+		recorded = t.paths[key]
+	}
+	if len(recorded) == 0 {
+		t.mutex.Unlock()
+		return nil, fmt.Errorf("没有记录的响应: %s", key)
+	}
+	// 同一请求被多次记录时按顺序回放，用完后重复最后一次
+	index := t.served[key]
+	if index >= len(recorded) {
+		index = len(recorded) - 1
+	}
+	t.served[key]++
+	exchange := recorded[index]
+	t.mutex.Unlock()
+
+	if exchange.Error != "" {
+		return nil, fmt.Errorf("%s", exchange.Error)
+	}
+
+	header := exchange.Header.Clone()
+	if header == nil {
+		header = make(http.Header)
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", exchange.StatusCode, http.StatusText(exchange.StatusCode)),
+		StatusCode:    exchange.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(exchange.Body)),
+		ContentLength: int64(len(exchange.Body)),
+		Request:       req,
+	}, nil
+}
+
+// NewReplayClient 创建使用记录回放的 http.Client，可直接传给 StreamTest
+func NewReplayClient(dir string) (*http.Client, error) {
+	transport, err := NewReplayTransport(dir)
+	if err != nil {
+		return nil, err
+	}
+	return &http.Client{Transport: transport}, nil
+}
@@ -0,0 +1,56 @@
+package unlock
+
+import (
+	"net/http"
+	"path/filepath"
+	"testing"
+)
+
+// testdata/bilibili 中记录的 session 参数与检测时随机生成的不同，回放时应忽略该参数
+func TestReplayBilibili(t *testing.T) {
+	client, err := NewReplayClient(filepath.Join("testdata", "bilibili"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mainland := TestBilibiliMainland(client)
+	if mainland.Status != "Success" || mainland.Region != "CHN" {
+		t.Errorf("mainland: got %s %s %s, want Success CHN", mainland.Status, mainland.Region, mainland.Info)
+	}
+
+	hkmctw := TestBilibiliHKMCTW(client)
+	if hkmctw.Status != "Failed" || hkmctw.Info != "Region Restricted" {
+		t.Errorf("hkmctw: got %s %s, want Failed Region Restricted", hkmctw.Status, hkmctw.Info)
+	}
+}
+
+func TestReplayFallbackToPath(t *testing.T) {
+	transport, err := NewReplayTransport(filepath.Join("testdata", "bilibili"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &http.Client{Transport: transport}
+	resp, err := client.Get("https://api.bilibili.com/pgc/player/web/playurl?avid=1")
+	if err != nil {
+		t.Fatalf("path fallback: %v", err)
+	}
+	resp.Body.Close()
+
+	if _, err := client.Get("https://api.bilibili.com/x/unknown"); err == nil {
+		t.Error("unrecorded path should fail")
+	}
+}
+
+func TestFixtureDir(t *testing.T) {
+	a := FixtureDir("root", "A/B")
+	b := FixtureDir("root", "A_B")
+	if a == b {
+		t.Errorf("A/B and A_B share fixture dir %s", a)
+	}
+	if filepath.Dir(a) != "root" {
+		t.Errorf("fixture dir %s escapes root", a)
+	}
+	if FixtureNodeName(filepath.Join("testdata", "bilibili")) != "HK 01" {
+		t.Error("node name not read from fixture")
+	}
+}
@@ -0,0 +1,346 @@
+package unlock
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultRiskProviders 默认使用的 IP 风险检测服务
+const DefaultRiskProviders = "ipcheck"
+
+// IP 类型
+const (
+	IPTypeResidential = "residential"
+	IPTypeDatacenter  = "datacenter"
+	IPTypeMobile      = "mobile"
+	IPTypeUnknown     = "unknown"
+)
+
+// RiskInfo 表示 IP 风险检测结果
+type RiskInfo struct {
+	Score  float64 `json:"score"`  // 风险值 0-100，越高越差
+	Type   string  `json:"type"`   // residential/datacenter/mobile/unknown
+	Proxy  bool    `json:"proxy"`  // 是否被识别为代理
+	VPN    bool    `json:"vpn"`    // 是否被识别为 VPN
+	Source string  `json:"source"` // 检测服务名称
+}
+
+// Level 返回风险等级描述
+func (r *RiskInfo) Level() string {
+	switch {
+	case r.Score == 0:
+		return "纯净"
+	case r.Score < 66:
+		return "一般"
+	case r.Score < 100:
+		return "较差"
+	default:
+		return "非常差"
+	}
+}
+
+// Format 格式化为 [12 一般] 形式
+func (r *RiskInfo) Format() string {
+	return fmt.Sprintf("[%.0f %s]", r.Score, r.Level())
+}
+
+// RiskProvider 定义 IP 风险检测服务
+type RiskProvider interface {
+	Name() string
+	Check(client *http.Client, ip string, debugMode bool) (*RiskInfo, error)
+}
+
+// ParseRiskProviders 解析逗号分隔的风险检测服务名称列表，ipqs 需要提供 API Key
+func ParseRiskProviders(names string, ipqsKey string) ([]RiskProvider, error) {
+	var providers []RiskProvider
+	for _, name := range strings.Split(names, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		switch name {
+		case "":
+			continue
+		case "ipcheck":
+			providers = append(providers, ipcheckRiskProvider{})
+		case "scamalytics":
+			providers = append(providers, scamalyticsRiskProvider{})
+		case "ipapi":
+			providers = append(providers, ipapiRiskProvider{})
+		case "ipqs":
+			if ipqsKey == "" {
+				return nil, fmt.Errorf("risk provider ipqs requires an api key")
+			}
+			providers = append(providers, ipqsRiskProvider{key: ipqsKey})
+		default:
+			return nil, fmt.Errorf("unknown risk provider: %s", name)
+		}
+	}
+	if len(providers) == 0 {
+		return nil, fmt.Errorf("no risk provider specified")
+	}
+	return providers, nil
+}
+
+// CheckRisk 按顺序使用风险检测服务，返回第一个成功的结果
+func CheckRisk(client *http.Client, providers []RiskProvider, ip string, debugMode bool) (*RiskInfo, error) {
+	if len(providers) == 0 {
+		providers = []RiskProvider{ipcheckRiskProvider{}}
+	}
+
+	// 创建一个新的客户端用于风险值请求
+	riskClient := &http.Client{
+		Timeout:   5 * time.Second,
+		Transport: client.Transport,
+	}
+
+	var lastErr error
+	for _, provider := range providers {
+		info, err := provider.Check(riskClient, ip, debugMode)
+		if err != nil {
+			if debugMode {
+				fmt.Printf("风险检测服务 %s 查询失败: %v\n", provider.Name(), err)
+			}
+			lastErr = err
+			continue
+		}
+		info.Source = provider.Name()
+		if info.Type == "" {
+			info.Type = IPTypeUnknown
+		}
+		if debugMode {
+			fmt.Printf("风险检测服务 %s: %+v\n", provider.Name(), *info)
+		}
+		return info, nil
+	}
+	return nil, fmt.Errorf("all risk providers failed: %v", lastErr)
+}
+
+// getRiskBody 使用随机请求头请求风险检测接口并返回解压后的响应体
+func getRiskBody(client *http.Client, url string, header http.Header, debugMode bool) ([]byte, error) {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// 使用随机请求头
+	isMobile := rand.Float32() < 0.3
+	req.Header = generateRandomHeaders(isMobile)
+	for key, values := range header {
+		req.Header[key] = values
+	}
+
+	// 使用重试机制获取风险值
+	resp, err := doRequestWithRetry(client, req, 3, debugMode)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := readCompressedBody(resp)
+	if err != nil {
+		return nil, err
+	}
+	if debugMode {
+		fmt.Printf("风险值响应: %s\n", string(body))
+	}
+	return body, nil
+}
+
+// normalizeIPType 将各服务返回的连接类型统一为 residential/datacenter/mobile
+func normalizeIPType(value string) string {
+	value = strings.ToLower(value)
+	switch {
+	case value == "":
+		return IPTypeUnknown
+	case strings.Contains(value, "mobile") || strings.Contains(value, "cellular") || strings.Contains(value, "wireless"):
+		return IPTypeMobile
+	case strings.Contains(value, "residential") || strings.Contains(value, "isp") || strings.Contains(value, "家宽") || strings.Contains(value, "住宅"):
+		return IPTypeResidential
+	case strings.Contains(value, "hosting") || strings.Contains(value, "data center") || strings.Contains(value, "datacenter") ||
+		strings.Contains(value, "business") || strings.Contains(value, "corporate") || strings.Contains(value, "机房") || strings.Contains(value, "数据中心"):
+		return IPTypeDatacenter
+	default:
+		return IPTypeUnknown
+	}
+}
+
+type ipcheckRiskProvider struct{}
+
+func (ipcheckRiskProvider) Name() string { return "ipcheck" }
+
+func (ipcheckRiskProvider) Check(client *http.Client, ip string, debugMode bool) (*RiskInfo, error) {
+	header := http.Header{}
+	// 添加必要的额外头
+	header.Set("Referer", "https://ipcheck.ing/")
+	header.Set("Origin", "https://ipcheck.ing/")
+
+	body, err := getRiskBody(client, fmt.Sprintf("https://ipcheck.ing/api/ipchecking?ip=%s&lang=zh-CN", ip), header, debugMode)
+	if err != nil {
+		return nil, err
+	}
+
+	var riskData struct {
+		ProxyDetect struct {
+			Proxy    string      `json:"proxy"`
+			Risk     interface{} `json:"risk"`
+			Type     string      `json:"type"`
+			Operator string      `json:"operator"`
+			Protocol string      `json:"protocol"`
+		} `json:"proxyDetect"`
+	}
+	if err := json.Unmarshal(body, &riskData); err != nil {
+		return nil, fmt.Errorf("解析风险值响应失败: %w", err)
+	}
+
+	if debugMode {
+		fmt.Printf("风险值类型: %T, 值: %v\n", riskData.ProxyDetect.Risk, riskData.ProxyDetect.Risk)
+	}
+
+	info := &RiskInfo{
+		Type:  normalizeIPType(riskData.ProxyDetect.Type),
+		Proxy: strings.EqualFold(riskData.ProxyDetect.Proxy, "yes"),
+		VPN:   strings.Contains(strings.ToLower(riskData.ProxyDetect.Protocol), "vpn"),
+	}
+	switch v := riskData.ProxyDetect.Risk.(type) {
+	case float64:
+		info.Score = v
+	case string:
+		if v == "" {
+			info.Score = 100
+		} else if f, err := strconv.ParseFloat(v, 64); err == nil {
+			info.Score = f
+		} else {
+			return nil, fmt.Errorf("unknown risk value: %v", v)
+		}
+	default:
+		return nil, fmt.Errorf("no risk information in response")
+	}
+	return info, nil
+}
+
+var (
+	scamalyticsScoreRe = regexp.MustCompile(`Fraud Score:\s*(\d+)`)
+	scamalyticsTagRe   = regexp.MustCompile(`<[^>]+>`)
+)
+
+type scamalyticsRiskProvider struct{}
+
+func (scamalyticsRiskProvider) Name() string { return "scamalytics" }
+
+func (scamalyticsRiskProvider) Check(client *http.Client, ip string, debugMode bool) (*RiskInfo, error) {
+	body, err := getRiskBody(client, fmt.Sprintf("https://scamalytics.com/ip/%s", ip), nil, false)
+	if err != nil {
+		return nil, err
+	}
+
+	// 去掉 HTML 标签后按表格文本匹配
+	text := strings.Join(strings.Fields(scamalyticsTagRe.ReplaceAllString(string(body), " ")), " ")
+	matches := scamalyticsScoreRe.FindStringSubmatch(text)
+	if len(matches) < 2 {
+		return nil, fmt.Errorf("fraud score not found")
+	}
+	score, _ := strconv.ParseFloat(matches[1], 64)
+
+	info := &RiskInfo{
+		Score: score,
+		VPN:   scamalyticsFlag(text, "Anonymizing VPN"),
+		Proxy: scamalyticsFlag(text, "Public Proxy") || scamalyticsFlag(text, "Web Proxy"),
+	}
+	if scamalyticsFlag(text, "Server") {
+		info.Type = IPTypeDatacenter
+	}
+	return info, nil
+}
+
+// scamalyticsFlag 判断表格中某项后紧跟的是否为 Yes
+func scamalyticsFlag(text, label string) bool {
+	index := strings.Index(text, label+" ")
+	if index < 0 {
+		return false
+	}
+	return strings.HasPrefix(text[index+len(label)+1:], "Yes")
+}
+
+type ipapiRiskProvider struct{}
+
+func (ipapiRiskProvider) Name() string { return "ipapi" }
+
+// Check ip-api 只提供代理/机房/移动网络标记，风险值按标记估算：代理 100，机房 50，其他 0
+func (ipapiRiskProvider) Check(client *http.Client, ip string, debugMode bool) (*RiskInfo, error) {
+	body, err := getRiskBody(client, fmt.Sprintf("http://ip-api.com/json/%s?fields=status,message,proxy,hosting,mobile", ip), nil, debugMode)
+	if err != nil {
+		return nil, err
+	}
+
+	var resp struct {
+		Status  string `json:"status"`
+		Message string `json:"message"`
+		Proxy   bool   `json:"proxy"`
+		Hosting bool   `json:"hosting"`
+		Mobile  bool   `json:"mobile"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, err
+	}
+	if resp.Status != "success" {
+		return nil, fmt.Errorf("ip-api: %s", resp.Message)
+	}
+
+	info := &RiskInfo{Proxy: resp.Proxy, Type: IPTypeResidential}
+	switch {
+	case resp.Mobile:
+		info.Type = IPTypeMobile
+	case resp.Hosting:
+		info.Type = IPTypeDatacenter
+		info.Score = 50
+	}
+	if resp.Proxy {
+		info.Score = 100
+	}
+	return info, nil
+}
+
+type ipqsRiskProvider struct {
+	key string
+}
+
+func (ipqsRiskProvider) Name() string { return "ipqs" }
+
+func (p ipqsRiskProvider) Check(client *http.Client, ip string, debugMode bool) (*RiskInfo, error) {
+	body, err := getRiskBody(client, fmt.Sprintf("https://ipqualityscore.com/api/json/ip/%s/%s", p.key, ip), nil, false)
+	if err != nil {
+		// 错误信息中包含请求地址，避免泄露 API Key
+		return nil, fmt.Errorf("%s", strings.ReplaceAll(err.Error(), p.key, "***"))
+	}
+
+	var resp struct {
+		Success        bool    `json:"success"`
+		Message        string  `json:"message"`
+		FraudScore     float64 `json:"fraud_score"`
+		Proxy          bool    `json:"proxy"`
+		VPN            bool    `json:"vpn"`
+		Mobile         bool    `json:"mobile"`
+		ConnectionType string  `json:"connection_type"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, err
+	}
+	if !resp.Success {
+		return nil, fmt.Errorf("ipqualityscore: %s", resp.Message)
+	}
+
+	info := &RiskInfo{
+		Score: resp.FraudScore,
+		Type:  normalizeIPType(resp.ConnectionType),
+		Proxy: resp.Proxy,
+		VPN:   resp.VPN,
+	}
+	if resp.Mobile {
+		info.Type = IPTypeMobile
+	}
+	return info, nil
+}